@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -18,6 +20,8 @@ type Config struct {
 	JWTSecret      string
 	APIPort        string
 	FrontendOrigin string
+	// SchedulerInterval is how often recurring expenses are auto-applied; 0 disables it.
+	SchedulerInterval time.Duration
 }
 
 // Load reads .env (either in backend/ or repo root) and exposes the configuration.
@@ -37,6 +41,12 @@ func Load() (*Config, error) {
 		FrontendOrigin: os.Getenv("FRONTEND_ORIGIN"),
 	}
 
+	interval, err := time.ParseDuration(fallback(os.Getenv("SCHEDULER_INTERVAL"), "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCHEDULER_INTERVAL: %w", err)
+	}
+	cfg.SchedulerInterval = interval
+
 	return cfg, nil
 }
 
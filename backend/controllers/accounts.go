@@ -0,0 +1,461 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+const accountColumns = `id, user_id, name, type, currency, opening_balance, closing_day, due_day, created_at`
+
+func scanAccount(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.Account, error) {
+	var account models.Account
+	var closingDay, dueDay sql.NullInt32
+	dest := append([]interface{}{&account.ID, &account.UserID, &account.Name, &account.Type, &account.Currency,
+		&account.OpeningBalance, &closingDay, &dueDay, &account.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return account, err
+	}
+	if closingDay.Valid {
+		day := int(closingDay.Int32)
+		account.ClosingDay = &day
+	}
+	if dueDay.Valid {
+		day := int(dueDay.Int32)
+		account.DueDay = &day
+	}
+	return account, nil
+}
+
+// bindAccount verifica que la cuenta pertenezca al usuario y devuelve su
+// moneda. Si no existe responde 400 y devuelve false.
+func (h *Handler) bindAccount(c *gin.Context, userID, accountID int64) (string, bool) {
+	var currency string
+	err := h.DB.QueryRow(`SELECT currency FROM accounts WHERE id=$1 AND user_id=$2`, accountID, userID).Scan(&currency)
+	if err == sql.ErrNoRows {
+		respondValidationError(c, "La cuenta indicada no existe", nil)
+		return "", false
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo verificar la cuenta", err)
+		return "", false
+	}
+	return currency, true
+}
+
+// bindOptionalAccount valida accountID si se envió. Un 0 significa quitar la
+// cuenta, y en ese caso devuelve ok sin consultar la base.
+func (h *Handler) bindOptionalAccount(c *gin.Context, userID int64, accountID *int64) bool {
+	if accountID == nil || *accountID == 0 {
+		return true
+	}
+	_, ok := h.bindAccount(c, userID, *accountID)
+	return ok
+}
+
+// accountArg convierte el accountId de un PATCH en el valor de la columna: un
+// 0 quita la cuenta y la deja en NULL.
+func accountArg(accountID int64) interface{} {
+	if accountID == 0 {
+		return nil
+	}
+	return accountID
+}
+
+// ListAccounts devuelve las cuentas del usuario. Con ?type=credit_card se
+// obtienen solo las tarjetas.
+func (h *Handler) ListAccounts(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var where whereBuilder
+	where.add("user_id=?", userID)
+	if typeParam := c.Query("type"); typeParam != "" {
+		accountType := models.AccountType(typeParam)
+		if !accountType.Valid() {
+			respondValidationError(c, "El tipo de cuenta debe ser cash, bank, credit_card o wallet", nil)
+			return
+		}
+		where.add("type=?", accountType)
+	}
+
+	rows, err := h.DB.Query(`SELECT `+accountColumns+` FROM accounts WHERE `+where.clause()+` ORDER BY name`, where.args...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de cuentas", err)
+		return
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de cuentas", err)
+			return
+		}
+		accounts = append(accounts, account)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+func (h *Handler) CreateAccount(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	var req struct {
+		Name           string             `json:"name" binding:"required"`
+		Type           models.AccountType `json:"type" binding:"required"`
+		OpeningBalance models.Money       `json:"openingBalance"`
+		// Currency es opcional; por defecto se usa la moneda base del usuario.
+		Currency string `json:"currency"`
+		// ClosingDay y DueDay son obligatorios para las tarjetas de crédito.
+		ClosingDay *int `json:"closingDay" binding:"omitempty,min=1,max=31"`
+		DueDay     *int `json:"dueDay" binding:"omitempty,min=1,max=31"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de la cuenta no son válidos", err)
+		return
+	}
+	if !req.Type.Valid() {
+		respondValidationError(c, "El tipo de cuenta debe ser cash, bank, credit_card o wallet", nil)
+		return
+	}
+	if req.Type == models.AccountCreditCard && (req.ClosingDay == nil || req.DueDay == nil) {
+		respondValidationError(c, "Las tarjetas de crédito necesitan 'closingDay' y 'dueDay'", nil)
+		return
+	}
+	if req.Type != models.AccountCreditCard && (req.ClosingDay != nil || req.DueDay != nil) {
+		respondValidationError(c, statementDaysOnlyForCards, nil)
+		return
+	}
+	currency, ok := bindCurrency(c, req.Currency)
+	if !ok {
+		return
+	}
+
+	account, err := scanAccount(h.DB.QueryRow(
+		`INSERT INTO accounts (user_id, name, type, opening_balance, currency, closing_day, due_day)
+		 VALUES ($1, $2, $3, $4, COALESCE($5, (SELECT base_currency FROM users WHERE id=$1)), $6, $7)
+		 RETURNING `+accountColumns,
+		userID, req.Name, req.Type, req.OpeningBalance, currency, req.ClosingDay, req.DueDay,
+	))
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondError(c, http.StatusBadRequest, "Ya existe una cuenta con ese nombre", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo guardar la cuenta", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"account": account})
+}
+
+// statementDaysOnlyForCards es el error que se devuelve al indicar días de
+// cierre o vencimiento en una cuenta que no es tarjeta de crédito.
+const statementDaysOnlyForCards = "Solo las tarjetas de crédito tienen día de cierre y de vencimiento"
+
+// UpdateAccount permite cambiar el nombre, el tipo, el saldo inicial y los días
+// de cierre y vencimiento. Al dejar de ser tarjeta, esos días se borran. La
+// moneda no se puede cambiar porque los movimientos ya están registrados en ella.
+func (h *Handler) UpdateAccount(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	accountID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la cuenta no es válido", err)
+		return
+	}
+
+	var req struct {
+		Name           *string             `json:"name" binding:"omitempty,min=1"`
+		Type           *models.AccountType `json:"type"`
+		OpeningBalance *models.Money       `json:"openingBalance"`
+		ClosingDay     *int                `json:"closingDay" binding:"omitempty,min=1,max=31"`
+		DueDay         *int                `json:"dueDay" binding:"omitempty,min=1,max=31"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de la cuenta no son válidos", err)
+		return
+	}
+
+	var set updateSet
+	if req.Name != nil {
+		set.add("name", *req.Name)
+	}
+	if req.Type != nil {
+		if !req.Type.Valid() {
+			respondValidationError(c, "El tipo de cuenta debe ser cash, bank, credit_card o wallet", nil)
+			return
+		}
+		set.add("type", *req.Type)
+	}
+	if req.OpeningBalance != nil {
+		set.add("opening_balance", *req.OpeningBalance)
+	}
+	if req.Type != nil && *req.Type != models.AccountCreditCard {
+		if req.ClosingDay != nil || req.DueDay != nil {
+			respondValidationError(c, statementDaysOnlyForCards, nil)
+			return
+		}
+		set.add("closing_day", nil)
+		set.add("due_day", nil)
+	}
+	if req.ClosingDay != nil {
+		set.add("closing_day", *req.ClosingDay)
+	}
+	if req.DueDay != nil {
+		set.add("due_day", *req.DueDay)
+	}
+	if set.empty() {
+		respondValidationError(c, "No se enviaron campos para actualizar", nil)
+		return
+	}
+
+	account, err := scanAccount(h.DB.QueryRow(
+		fmt.Sprintf(
+			`UPDATE accounts
+			 SET %s
+			 WHERE id=$%d AND user_id=$%d
+			 RETURNING `+accountColumns,
+			set.clause(), set.next(), set.next()+1,
+		),
+		set.argsWith(accountID, userID)...,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró la cuenta solicitada", nil)
+			return
+		}
+		if isUniqueViolation(err) {
+			respondError(c, http.StatusBadRequest, "Ya existe una cuenta con ese nombre", nil)
+			return
+		}
+		if isCheckViolation(err) {
+			respondError(c, http.StatusBadRequest, statementDaysOnlyForCards, nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar la cuenta", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"account": account})
+}
+
+// DeleteAccount borra la cuenta. Los gastos e ingresos se conservan sin
+// cuenta asociada; si la cuenta tiene transferencias se rechaza, ya que
+// borrarlas cambiaría el saldo de la otra cuenta.
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	accountID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la cuenta no es válido", err)
+		return
+	}
+
+	result, err := h.DB.Exec(`DELETE FROM accounts WHERE id=$1 AND user_id=$2`, accountID, userID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			respondError(c, http.StatusConflict, "La cuenta tiene transferencias; elimínelas antes de borrar la cuenta", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo eliminar la cuenta", err)
+		return
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la eliminación de la cuenta", err)
+		return
+	}
+	if rows == 0 {
+		respondError(c, http.StatusNotFound, "No se encontró la cuenta solicitada", nil)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AccountBalances calcula el saldo actual de cada cuenta del usuario.
+func (h *Handler) AccountBalances(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	rows, err := h.DB.Query(
+		`SELECT `+accountColumns+`,
+			COALESCE((SELECT SUM(i.amount) FROM incomes i
+				WHERE i.account_id = accounts.id AND i.currency = accounts.currency AND i.income_date <= CURRENT_DATE), 0),
+			COALESCE((SELECT SUM(e.amount) FROM expenses e
+				WHERE e.account_id = accounts.id AND e.currency = accounts.currency AND e.expense_date <= CURRENT_DATE), 0),
+			COALESCE((SELECT SUM(t.to_amount) FROM transfers t
+				WHERE t.to_account_id = accounts.id AND t.transfer_date <= CURRENT_DATE), 0),
+			COALESCE((SELECT SUM(t.amount) FROM transfers t
+				WHERE t.from_account_id = accounts.id AND t.transfer_date <= CURRENT_DATE), 0),
+			(SELECT COUNT(*) FROM incomes i
+				WHERE i.account_id = accounts.id AND i.currency <> accounts.currency AND i.income_date <= CURRENT_DATE)
+				+ (SELECT COUNT(*) FROM expenses e
+				WHERE e.account_id = accounts.id AND e.currency <> accounts.currency AND e.expense_date <= CURRENT_DATE)
+		 FROM accounts
+		 WHERE user_id=$1
+		 ORDER BY name`,
+		userID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron calcular los saldos de las cuentas", err)
+		return
+	}
+	defer rows.Close()
+
+	balances := []models.AccountBalance{}
+	for rows.Next() {
+		var balance models.AccountBalance
+		account, err := scanAccount(rows, &balance.Incomes, &balance.Expenses, &balance.TransfersIn, &balance.TransfersOut, &balance.Excluded)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudieron leer los saldos de las cuentas", err)
+			return
+		}
+		balance.Account = account
+		balance.Balance = account.OpeningBalance + balance.Incomes - balance.Expenses + balance.TransfersIn - balance.TransfersOut
+		balances = append(balances, balance)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"balances": balances})
+}
+
+const transferColumns = `id, from_account_id, to_account_id, amount, to_amount, transfer_date, note`
+
+func scanTransfer(row interface{ Scan(...interface{}) error }) (models.Transfer, error) {
+	var transfer models.Transfer
+	var date time.Time
+	if err := row.Scan(&transfer.ID, &transfer.FromAccountID, &transfer.ToAccountID, &transfer.Amount,
+		&transfer.ToAmount, &date, &transfer.Note); err != nil {
+		return transfer, err
+	}
+	transfer.Date = date.Format("2006-01-02")
+	return transfer, nil
+}
+
+func (h *Handler) ListTransfers(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var where whereBuilder
+	where.add("user_id=?", userID)
+	if accountParam := c.Query("accountId"); accountParam != "" {
+		accountID, err := strconv.ParseInt(accountParam, 10, 64)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'accountId' no es válido", err)
+			return
+		}
+		where.add("(from_account_id=? OR to_account_id=?)", accountID, accountID)
+	}
+
+	rows, err := h.DB.Query(
+		`SELECT `+transferColumns+` FROM transfers WHERE `+where.clause()+` ORDER BY transfer_date DESC, id DESC`,
+		where.args...,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de transferencias", err)
+		return
+	}
+	defer rows.Close()
+
+	transfers := []models.Transfer{}
+	for rows.Next() {
+		transfer, err := scanTransfer(rows)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de transferencias", err)
+			return
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transfers": transfers})
+}
+
+// CreateTransfer registra un movimiento entre dos cuentas del usuario. Si las
+// cuentas usan monedas distintas hay que indicar toAmount, lo que llega a la
+// cuenta destino.
+func (h *Handler) CreateTransfer(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	var req struct {
+		FromAccountID int64         `json:"fromAccountId" binding:"required"`
+		ToAccountID   int64         `json:"toAccountId" binding:"required"`
+		Amount        models.Money  `json:"amount" binding:"required,gt=0"`
+		ToAmount      *models.Money `json:"toAmount" binding:"omitempty,gt=0"`
+		Date          string        `json:"date" binding:"required"`
+		Note          string        `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de la transferencia no son válidos", err)
+		return
+	}
+	if req.FromAccountID == req.ToAccountID {
+		respondValidationError(c, "La cuenta de origen y la de destino deben ser distintas", nil)
+		return
+	}
+	transferDate, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		respondValidationError(c, "La fecha de la transferencia no tiene el formato correcto", err)
+		return
+	}
+
+	fromCurrency, ok := h.bindAccount(c, userID, req.FromAccountID)
+	if !ok {
+		return
+	}
+	toCurrency, ok := h.bindAccount(c, userID, req.ToAccountID)
+	if !ok {
+		return
+	}
+	toAmount := req.Amount
+	if req.ToAmount != nil {
+		toAmount = *req.ToAmount
+	} else if fromCurrency != toCurrency {
+		respondValidationError(c, "Las cuentas usan monedas distintas, por lo que 'toAmount' es obligatorio", nil)
+		return
+	}
+
+	transfer, err := scanTransfer(h.DB.QueryRow(
+		`INSERT INTO transfers (user_id, from_account_id, to_account_id, amount, to_amount, transfer_date, note)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+transferColumns,
+		userID, req.FromAccountID, req.ToAccountID, req.Amount, toAmount, transferDate, req.Note,
+	))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo guardar la transferencia", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"transfer": transfer})
+}
+
+func (h *Handler) DeleteTransfer(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	transferID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la transferencia no es válido", err)
+		return
+	}
+
+	result, err := h.DB.Exec(`DELETE FROM transfers WHERE id=$1 AND user_id=$2`, transferID, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo eliminar la transferencia", err)
+		return
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la eliminación de la transferencia", err)
+		return
+	}
+	if rows == 0 {
+		respondError(c, http.StatusNotFound, "No se encontró la transferencia solicitada", nil)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
+)
+
+// accountColumnNames are the columns returned by queries selecting accountColumns.
+var accountColumnNames = strings.Split(accountColumns, ", ")
+
+func TestCreateAccount_InvalidType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/accounts", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateAccount(c)
+	})
+
+	body := `{"name": "Colchón", "type": "mattress"}`
+	req, _ := http.NewRequest("POST", "/accounts", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "cash, bank, credit_card o wallet")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAccount_CardRequiresStatementDays(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/accounts", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateAccount(c)
+	})
+
+	body := `{"name": "Visa", "type": "credit_card", "closingDay": 25}`
+	req, _ := http.NewRequest("POST", "/accounts", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "'closingDay' y 'dueDay'")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAccountBalances(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/accounts/balances", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.AccountBalances(c)
+	})
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Movements in another currency are only counted as excluded up to today,
+	// like the ones added to the balance.
+	mock.ExpectQuery(`e.currency <> accounts.currency AND e.expense_date <= CURRENT_DATE\)\s+FROM accounts\s+WHERE user_id=\$1\s+ORDER BY name`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(append(accountColumnNames, "incomes", "expenses", "transfers_in", "transfers_out", "excluded")).
+			AddRow(1, 1, "Banco", "bank", "ARS", "1000.00", nil, nil, createdAt, "5000.00", "1200.50", "0", "300.00", 0).
+			AddRow(2, 1, "Efectivo", "cash", "ARS", "0", nil, nil, createdAt, "0", "150.00", "300.00", "0", 1))
+
+	req, _ := http.NewRequest("GET", "/accounts/balances", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Banco"`)
+	assert.Contains(t, w.Body.String(), `"balance":4499.50`)
+	assert.Contains(t, w.Body.String(), `"balance":150.00,"excluded":1`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteAccount_WithTransfers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.DELETE("/accounts/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.DeleteAccount(c)
+	})
+
+	mock.ExpectExec(`DELETE FROM accounts WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(3), int64(1)).
+		WillReturnError(&pq.Error{Code: "23503"})
+
+	req, _ := http.NewRequest("DELETE", "/accounts/3", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "La cuenta tiene transferencias")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateTransfer_DifferentCurrenciesRequireToAmount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/transfers", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateTransfer(c)
+	})
+
+	mock.ExpectQuery(`SELECT currency FROM accounts WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow("ARS"))
+	mock.ExpectQuery(`SELECT currency FROM accounts WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(2), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow("USD"))
+
+	body := `{"fromAccountId": 1, "toAccountId": 2, "amount": 100000, "date": "2024-03-10"}`
+	req, _ := http.NewRequest("POST", "/transfers", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "'toAmount' es obligatorio")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateTransfer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/transfers", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateTransfer(c)
+	})
+
+	for _, id := range []int64{1, 3} {
+		mock.ExpectQuery(`SELECT currency FROM accounts`).
+			WithArgs(id, int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow("ARS"))
+	}
+	mock.ExpectQuery("INSERT INTO transfers").
+		WithArgs(int64(1), int64(1), int64(3), models.Money(2500000), models.Money(2500000), sqlmock.AnyArg(), "Carga de billetera").
+		WillReturnRows(sqlmock.NewRows(strings.Split(transferColumns, ", ")).
+			AddRow(5, 1, 3, "25000.00", "25000.00", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), "Carga de billetera"))
+
+	body := `{"fromAccountId": 1, "toAccountId": 3, "amount": 25000, "date": "2024-03-10", "note": "Carga de billetera"}`
+	req, _ := http.NewRequest("POST", "/transfers", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"toAmount":25000.00`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -43,9 +43,9 @@ func (h *Handler) Register(c *gin.Context) {
 	var u models.User
 	err = h.DB.QueryRow(
 		`INSERT INTO users (name, email, password_hash) VALUES ($1, $2, $3)
-			RETURNING id, name, email, created_at`,
+			RETURNING id, name, email, base_currency, created_at`,
 		req.Name, req.Email, string(hash),
-	).Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt)
+	).Scan(&u.ID, &u.Name, &u.Email, &u.BaseCurrency, &u.CreatedAt)
 	if err != nil {
 		respondError(c, http.StatusInternalServerError, "No se pudo guardar el usuario", err)
 		return
@@ -74,9 +74,9 @@ func (h *Handler) Login(c *gin.Context) {
 	var u models.User
 	var passwordHash string
 	err := h.DB.QueryRow(
-		`SELECT id, name, email, password_hash, created_at FROM users WHERE email=$1`,
+		`SELECT id, name, email, password_hash, base_currency, created_at FROM users WHERE email=$1`,
 		req.Email,
-	).Scan(&u.ID, &u.Name, &u.Email, &passwordHash, &u.CreatedAt)
+	).Scan(&u.ID, &u.Name, &u.Email, &passwordHash, &u.BaseCurrency, &u.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			respondError(c, http.StatusUnauthorized, "Credenciales inválidas", nil)
@@ -109,9 +109,9 @@ func (h *Handler) Me(c *gin.Context) {
 
 	var u models.User
 	err := h.DB.QueryRow(
-		`SELECT id, name, email, created_at FROM users WHERE id=$1`,
+		`SELECT id, name, email, base_currency, created_at FROM users WHERE id=$1`,
 		userID,
-	).Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt)
+	).Scan(&u.ID, &u.Name, &u.Email, &u.BaseCurrency, &u.CreatedAt)
 	if err != nil {
 		respondError(c, http.StatusInternalServerError, "No se pudo obtener el perfil del usuario", err)
 		return
@@ -120,6 +120,54 @@ func (h *Handler) Me(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"user": u})
 }
 
+// UpdateMe cambia la moneda base del usuario, usada para convertir los montos
+// en los listados y resúmenes.
+func (h *Handler) UpdateMe(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	var req struct {
+		BaseCurrency string `json:"baseCurrency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos enviados no son válidos", err)
+		return
+	}
+	currency, ok := bindCurrency(c, req.BaseCurrency)
+	if !ok {
+		return
+	}
+
+	var u models.User
+	err := h.DB.QueryRow(
+		`UPDATE users SET base_currency=$1 WHERE id=$2
+			RETURNING id, name, email, base_currency, created_at`,
+		*currency, userID,
+	).Scan(&u.ID, &u.Name, &u.Email, &u.BaseCurrency, &u.CreatedAt)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el perfil del usuario", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": u})
+}
+
+// RequireAdmin corta la petición si el usuario autenticado no es administrador.
+// Debe usarse después de middleware.Auth.
+func (h *Handler) RequireAdmin(c *gin.Context) {
+	var isAdmin bool
+	err := h.DB.QueryRow(`SELECT is_admin FROM users WHERE id=$1`, c.GetInt64("userID")).Scan(&isAdmin)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondError(c, http.StatusInternalServerError, "No se pudieron verificar los permisos del usuario", err)
+		c.Abort()
+		return
+	}
+	if !isAdmin {
+		respondError(c, http.StatusForbidden, "Esta operación requiere permisos de administrador", nil)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
 func (h *Handler) generateToken(userID int64) (string, error) {
 	claims := jwt.MapClaims{
 		"sub": userID,
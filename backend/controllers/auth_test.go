@@ -33,8 +33,8 @@ func TestRegister_Success(t *testing.T) {
 	// Expect insert user
 	mock.ExpectQuery("INSERT INTO users").
 		WithArgs("Test User", "test@example.com", sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at"}).
-			AddRow(1, "Test User", "test@example.com", time.Now()))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "base_currency", "created_at"}).
+			AddRow(1, "Test User", "test@example.com", "ARS", time.Now()))
 
 	body := `{"name": "Test User", "email": "test@example.com", "password": "password123"}`
 	req, _ := http.NewRequest("POST", "/register", bytes.NewBufferString(body))
@@ -87,10 +87,10 @@ func TestLogin_Success(t *testing.T) {
 	password := "password123"
 	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 
-	mock.ExpectQuery("SELECT id, name, email, password_hash, created_at FROM users").
+	mock.ExpectQuery("SELECT id, name, email, password_hash, base_currency, created_at FROM users").
 		WithArgs("test@example.com").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password_hash", "created_at"}).
-			AddRow(1, "Test User", "test@example.com", string(hash), time.Now()))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password_hash", "base_currency", "created_at"}).
+			AddRow(1, "Test User", "test@example.com", string(hash), "ARS", time.Now()))
 
 	body := `{"email": "test@example.com", "password": "password123"}`
 	req, _ := http.NewRequest("POST", "/login", bytes.NewBufferString(body))
@@ -115,7 +115,7 @@ func TestLogin_InvalidCredentials(t *testing.T) {
 	router.POST("/login", handler.Login)
 
 	// Case 1: User not found
-	mock.ExpectQuery("SELECT id, name, email, password_hash, created_at FROM users").
+	mock.ExpectQuery("SELECT id, name, email, password_hash, base_currency, created_at FROM users").
 		WithArgs("wrong@example.com").
 		WillReturnError(sql.ErrNoRows)
 
@@ -166,10 +166,10 @@ func TestLogin_WrongPassword(t *testing.T) {
 	// Hash for "correctpassword"
 	hash, _ := bcrypt.GenerateFromPassword([]byte("correctpassword"), bcrypt.DefaultCost)
 
-	mock.ExpectQuery("SELECT id, name, email, password_hash, created_at FROM users").
+	mock.ExpectQuery("SELECT id, name, email, password_hash, base_currency, created_at FROM users").
 		WithArgs("test@example.com").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password_hash", "created_at"}).
-			AddRow(1, "Test User", "test@example.com", string(hash), time.Now()))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password_hash", "base_currency", "created_at"}).
+			AddRow(1, "Test User", "test@example.com", string(hash), "ARS", time.Now()))
 
 	body := `{"email": "test@example.com", "password": "wrongpassword"}`
 	req, _ := http.NewRequest("POST", "/login", bytes.NewBufferString(body))
@@ -218,10 +218,10 @@ func TestMe_Success(t *testing.T) {
 		handler.Me(c)
 	})
 
-	mock.ExpectQuery("SELECT id, name, email, created_at FROM users").
+	mock.ExpectQuery("SELECT id, name, email, base_currency, created_at FROM users").
 		WithArgs(int64(1)).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at"}).
-			AddRow(1, "Test User", "test@example.com", time.Now()))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "base_currency", "created_at"}).
+			AddRow(1, "Test User", "test@example.com", "ARS", time.Now()))
 
 	req, _ := http.NewRequest("GET", "/me", nil)
 	w := httptest.NewRecorder()
@@ -267,7 +267,7 @@ func TestMe_DBError(t *testing.T) {
 		handler.Me(c)
 	})
 
-	mock.ExpectQuery("SELECT id, name, email, created_at FROM users").
+	mock.ExpectQuery("SELECT id, name, email, base_currency, created_at FROM users").
 		WithArgs(int64(1)).
 		WillReturnError(sql.ErrConnDone)
 
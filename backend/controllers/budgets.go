@@ -0,0 +1,405 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+func scanBudget(row interface{ Scan(...interface{}) error }) (models.Budget, error) {
+	var b models.Budget
+	var startsOn sql.NullTime
+	if err := row.Scan(&b.ID, &b.UserID, &b.Tag, &b.Limit, &startsOn, &b.Rollover); err != nil {
+		return b, err
+	}
+	if startsOn.Valid {
+		month := startsOn.Time.Format("2006-01")
+		b.StartMonth = &month
+	}
+	return b, nil
+}
+
+func (h *Handler) ListBudgets(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	rows, err := h.DB.Query(
+		`SELECT id, user_id, tag, monthly_limit, starts_on, rollover
+		 FROM budgets
+		 WHERE user_id=$1
+		 ORDER BY tag`, userID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de presupuestos", err)
+		return
+	}
+	defer rows.Close()
+
+	budgets := []models.Budget{}
+	for rows.Next() {
+		b, err := scanBudget(rows)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de presupuestos", err)
+			return
+		}
+		budgets = append(budgets, b)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"budgets": budgets})
+}
+
+func (h *Handler) CreateBudget(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	var req struct {
+		Tag        string       `json:"tag" binding:"required"`
+		Limit      models.Money `json:"limit" binding:"required,gt=0"`
+		StartMonth *string      `json:"startMonth"`
+		Rollover   bool         `json:"rollover"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos del presupuesto no son válidos", err)
+		return
+	}
+
+	var startsOn *time.Time
+	if req.StartMonth != nil {
+		month, err := parseMonth(*req.StartMonth)
+		if err != nil {
+			respondValidationError(c, "El mes de inicio debe usar el formato YYYY-MM", err)
+			return
+		}
+		startsOn = &month
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la creación del presupuesto", err)
+		return
+	}
+	defer tx.Rollback()
+
+	tag, ok := bindCategory(c, tx, userID, req.Tag)
+	if !ok {
+		return
+	}
+
+	b, err := scanBudget(tx.QueryRowContext(c,
+		`INSERT INTO budgets (user_id, tag, monthly_limit, starts_on, rollover)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id, user_id, tag, monthly_limit, starts_on, rollover`,
+		userID, tag, req.Limit, startsOn, req.Rollover,
+	))
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondError(c, http.StatusBadRequest, "Ya existe un presupuesto para esa etiqueta", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo guardar el presupuesto", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la creación del presupuesto", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"budget": b})
+}
+
+func (h *Handler) UpdateBudget(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	budgetID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del presupuesto no es válido", err)
+		return
+	}
+
+	var req struct {
+		Tag   *string       `json:"tag" binding:"omitempty,min=1"`
+		Limit *models.Money `json:"limit" binding:"omitempty,gt=0"`
+		// Un string vacío quita el mes de inicio.
+		StartMonth *string `json:"startMonth"`
+		Rollover   *bool   `json:"rollover"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos del presupuesto no son válidos", err)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la actualización del presupuesto", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var set updateSet
+	if req.Tag != nil {
+		tag, ok := bindCategory(c, tx, userID, *req.Tag)
+		if !ok {
+			return
+		}
+		set.add("tag", tag)
+	}
+	if req.Limit != nil {
+		set.add("monthly_limit", *req.Limit)
+	}
+	if req.StartMonth != nil {
+		if *req.StartMonth == "" {
+			set.add("starts_on", nil)
+		} else {
+			month, err := parseMonth(*req.StartMonth)
+			if err != nil {
+				respondValidationError(c, "El mes de inicio debe usar el formato YYYY-MM", err)
+				return
+			}
+			set.add("starts_on", month)
+		}
+	}
+	if req.Rollover != nil {
+		set.add("rollover", *req.Rollover)
+	}
+	if set.empty() {
+		respondValidationError(c, "No se enviaron campos para actualizar", nil)
+		return
+	}
+
+	b, err := scanBudget(tx.QueryRowContext(c,
+		fmt.Sprintf(
+			`UPDATE budgets
+			 SET %s
+			 WHERE id=$%d AND user_id=$%d
+			 RETURNING id, user_id, tag, monthly_limit, starts_on, rollover`,
+			set.clause(), set.next(), set.next()+1,
+		),
+		set.argsWith(budgetID, userID)...,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el presupuesto solicitado", nil)
+			return
+		}
+		if isUniqueViolation(err) {
+			respondError(c, http.StatusBadRequest, "Ya existe un presupuesto para esa etiqueta", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el presupuesto", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la actualización del presupuesto", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"budget": b})
+}
+
+func (h *Handler) DeleteBudget(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	budgetID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del presupuesto no es válido", err)
+		return
+	}
+
+	result, err := h.DB.Exec(`DELETE FROM budgets WHERE id=$1 AND user_id=$2`, budgetID, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo eliminar el presupuesto", err)
+		return
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la eliminación del presupuesto", err)
+		return
+	}
+	if rows == 0 {
+		respondError(c, http.StatusNotFound, "No se encontró el presupuesto solicitado", nil)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// budgetSpentSQL convierte cada gasto a la moneda base del usuario, que es la
+// de los límites de los presupuestos. Los gastos sin cotización no suman.
+var budgetSpentSQL = convertedAmountFor("e", "e.expense_date")
+
+func (h *Handler) BudgetsStatus(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	month := time.Now()
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if monthParam := c.Query("month"); monthParam != "" {
+		parsed, err := parseMonth(monthParam)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'month' debe usar el formato YYYY-MM", err)
+			return
+		}
+		month = parsed
+	}
+	nextMonth := month.AddDate(0, 1, 0)
+
+	rows, err := h.DB.Query(
+		`SELECT b.id, b.tag, b.monthly_limit, COALESCE(SUM(`+budgetSpentSQL+`), 0), COUNT(e.id) - COUNT(`+budgetSpentSQL+`)
+		 FROM budgets b
+		 LEFT JOIN expenses e
+		   ON e.user_id = b.user_id AND e.tag = b.tag
+		  AND e.expense_date >= $2 AND e.expense_date < $3
+		 WHERE b.user_id=$1 AND (b.starts_on IS NULL OR b.starts_on <= $2)
+		 GROUP BY b.id, b.tag, b.monthly_limit
+		 ORDER BY b.tag`,
+		userID, month, nextMonth,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo calcular el estado de los presupuestos", err)
+		return
+	}
+	defer rows.Close()
+
+	statuses := []models.BudgetStatus{}
+	for rows.Next() {
+		var status models.BudgetStatus
+		if err := rows.Scan(&status.BudgetID, &status.Tag, &status.Limit, &status.Spent, &status.Unconverted); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer el estado de los presupuestos", err)
+			return
+		}
+		status.Remaining = status.Limit - status.Spent
+		if status.Limit > 0 {
+			status.Percentage = math.Round(status.Spent.Float()/status.Limit.Float()*10000) / 100
+		}
+		statuses = append(statuses, status)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"month":    month.Format("2006-01"),
+		"statuses": statuses,
+	})
+}
+
+// buildEnvelopeLedger recorre mes a mes desde start hasta end (inclusive). Con
+// rollover el disponible de cada mes pasa al siguiente, sea sobrante o exceso;
+// sin rollover cada mes arranca solo con el límite.
+func buildEnvelopeLedger(limit models.Money, rollover bool, start, end time.Time, spentByMonth map[string]models.Money) []models.EnvelopeMonth {
+	ledger := []models.EnvelopeMonth{}
+	var carryOver models.Money
+	for month := start; !month.After(end); month = month.AddDate(0, 1, 0) {
+		key := month.Format("2006-01")
+		spent := spentByMonth[key]
+		entry := models.EnvelopeMonth{
+			Month:     key,
+			Limit:     limit,
+			CarryOver: carryOver,
+			Spent:     spent,
+			Available: limit + carryOver - spent,
+		}
+		ledger = append(ledger, entry)
+
+		carryOver = 0
+		if rollover {
+			carryOver = entry.Available
+		}
+	}
+	return ledger
+}
+
+func (h *Handler) BudgetEnvelopes(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	end := time.Now()
+	end = time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if toParam := c.Query("to"); toParam != "" {
+		parsed, err := parseMonth(toParam)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'to' debe usar el formato YYYY-MM", err)
+			return
+		}
+		end = parsed
+	}
+
+	// Sin mes de inicio explícito, el sobre arranca el mes en que se creó el presupuesto.
+	rows, err := h.DB.Query(
+		`SELECT id, tag, monthly_limit, rollover,
+		        COALESCE(starts_on, date_trunc('month', created_at)::date)
+		 FROM budgets
+		 WHERE user_id=$1
+		 ORDER BY tag`, userID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de presupuestos", err)
+		return
+	}
+	defer rows.Close()
+
+	type envelopeSource struct {
+		envelope models.Envelope
+		limit    models.Money
+		start    time.Time
+	}
+	var sources []envelopeSource
+	for rows.Next() {
+		var src envelopeSource
+		if err := rows.Scan(&src.envelope.BudgetID, &src.envelope.Tag, &src.limit, &src.envelope.Rollover, &src.start); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de presupuestos", err)
+			return
+		}
+		sources = append(sources, src)
+	}
+	rows.Close()
+
+	spentRows, err := h.DB.Query(
+		`SELECT b.id, date_trunc('month', e.expense_date)::date, COALESCE(SUM(`+budgetSpentSQL+`), 0), COUNT(*) - COUNT(`+budgetSpentSQL+`)
+		 FROM budgets b
+		 JOIN expenses e ON e.user_id = b.user_id AND e.tag = b.tag
+		 WHERE b.user_id=$1
+		   AND e.expense_date >= COALESCE(b.starts_on, date_trunc('month', b.created_at)::date)
+		   AND e.expense_date < $2
+		 GROUP BY b.id, 2`,
+		userID, end.AddDate(0, 1, 0),
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo calcular el gasto de los sobres", err)
+		return
+	}
+	defer spentRows.Close()
+
+	spent := map[int64]map[string]models.Money{}
+	unconverted := map[int64]map[string]int64{}
+	for spentRows.Next() {
+		var budgetID int64
+		var month time.Time
+		var total models.Money
+		var missing int64
+		if err := spentRows.Scan(&budgetID, &month, &total, &missing); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer el gasto de los sobres", err)
+			return
+		}
+		if spent[budgetID] == nil {
+			spent[budgetID] = map[string]models.Money{}
+			unconverted[budgetID] = map[string]int64{}
+		}
+		spent[budgetID][month.Format("2006-01")] = total
+		unconverted[budgetID][month.Format("2006-01")] = missing
+	}
+
+	envelopes := []models.Envelope{}
+	for _, src := range sources {
+		env := src.envelope
+		start := time.Date(src.start.Year(), src.start.Month(), 1, 0, 0, 0, 0, time.UTC)
+		env.Months = buildEnvelopeLedger(src.limit, env.Rollover, start, end, spent[env.BudgetID])
+		for i := range env.Months {
+			env.Months[i].Unconverted = unconverted[env.BudgetID][env.Months[i].Month]
+		}
+		envelopes = append(envelopes, env)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"envelopes": envelopes})
+}
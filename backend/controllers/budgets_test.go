@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
+)
+
+var budgetColumns = []string{"id", "user_id", "tag", "monthly_limit", "starts_on", "rollover"}
+
+func TestListBudgets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/budgets", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ListBudgets(c)
+	})
+
+	mock.ExpectQuery("SELECT id, user_id, tag, monthly_limit, starts_on, rollover FROM budgets").
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(budgetColumns).
+			AddRow(1, 1, "Food", 100000.0, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), false))
+
+	req, _ := http.NewRequest("GET", "/budgets", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"startMonth":"2024-03"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateBudget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/budgets", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateBudget(c)
+	})
+
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Food")
+	mock.ExpectQuery("INSERT INTO budgets").
+		WithArgs(int64(1), "Food", models.Money(10000000), sqlmock.AnyArg(), true).
+		WillReturnRows(sqlmock.NewRows(budgetColumns).AddRow(1, 1, "Food", 100000.0, nil, true))
+	mock.ExpectCommit()
+
+	body := `{"tag": "Food", "limit": 100000, "rollover": true}`
+	req, _ := http.NewRequest("POST", "/budgets", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), "Food")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateBudget_DuplicateTag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/budgets", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateBudget(c)
+	})
+
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Food")
+	mock.ExpectQuery("INSERT INTO budgets").
+		WithArgs(int64(1), "Food", models.Money(10000000), sqlmock.AnyArg(), false).
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	body := `{"tag": "Food", "limit": 100000, "startMonth": "2024-03"}`
+	req, _ := http.NewRequest("POST", "/budgets", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Ya existe un presupuesto para esa etiqueta")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateBudget_ValidationError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/budgets", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateBudget(c)
+	})
+
+	for _, body := range []string{`{"tag": "Food", "limit": -5}`, `{"tag": "Food", "limit": 10, "startMonth": "marzo"}`} {
+		req, _ := http.NewRequest("POST", "/budgets", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestUpdateBudget_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/budgets/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateBudget(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE budgets\s+SET monthly_limit=\$1\s+WHERE id=\$2 AND user_id=\$3`).
+		WithArgs(models.Money(500000), int64(9), int64(1)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("PATCH", "/budgets/9", bytes.NewBufferString(`{"limit": 5000}`))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "No se encontró el presupuesto solicitado")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteBudget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.DELETE("/budgets/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.DeleteBudget(c)
+	})
+
+	mock.ExpectExec("DELETE FROM budgets").
+		WithArgs(int64(1), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req, _ := http.NewRequest("DELETE", "/budgets/1", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBudgetsStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/budgets/status", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.BudgetsStatus(c)
+	})
+
+	mock.ExpectQuery(`SUM\(\(SELECT CASE WHEN e.currency = u.base_currency .* FROM budgets b`).
+		WithArgs(int64(1), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tag", "monthly_limit", "spent", "unconverted"}).
+			AddRow(1, "Food", 1000.0, 250.0, 0).
+			AddRow(2, "Fun", 200.0, 300.0, 1))
+
+	req, _ := http.NewRequest("GET", "/budgets/status?month=2024-03", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"remaining":750.00,"percentage":25`)
+	assert.Contains(t, w.Body.String(), `"remaining":-100.00,"percentage":150,"unconverted":1`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBudgetsStatus_InvalidMonth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/budgets/status", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.BudgetsStatus(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/budgets/status?month=2024-13", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "El parámetro 'month' debe usar el formato YYYY-MM")
+}
+
+func TestBuildEnvelopeLedger(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	spent := map[string]models.Money{"2024-01": 6000, "2024-02": 15000}
+
+	ledger := buildEnvelopeLedger(10000, true, start, end, spent)
+	assert.Len(t, ledger, 3)
+	assert.Equal(t, models.Money(4000), ledger[0].Available)
+	assert.Equal(t, models.Money(4000), ledger[1].CarryOver)
+	assert.Equal(t, models.Money(-1000), ledger[1].Available)
+	assert.Equal(t, models.Money(-1000), ledger[2].CarryOver)
+	assert.Equal(t, models.Money(9000), ledger[2].Available)
+
+	reset := buildEnvelopeLedger(10000, false, start, end, spent)
+	assert.Equal(t, models.Money(0), reset[1].CarryOver)
+	assert.Equal(t, models.Money(-5000), reset[1].Available)
+	assert.Equal(t, models.Money(0), reset[2].CarryOver)
+}
+
+func TestBudgetEnvelopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/budgets/envelopes", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.BudgetEnvelopes(c)
+	})
+
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT id, tag, monthly_limit, rollover").
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tag", "monthly_limit", "rollover", "start"}).
+			AddRow(1, "Food", 100.0, true, jan))
+	mock.ExpectQuery(`SUM\(\(SELECT CASE WHEN e.currency = u.base_currency .* JOIN expenses e`).
+		WithArgs(int64(1), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "month", "sum", "unconverted"}).
+			AddRow(1, jan, 60.0, 0))
+
+	req, _ := http.NewRequest("GET", "/budgets/envelopes?to=2024-02", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `{"month":"2024-02","limit":100.00,"carryOver":40.00,"spent":0.00,"available":140.00,"unconverted":0}`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+// maxStatementCycles limita la cantidad de resúmenes que se calculan por consulta.
+const maxStatementCycles = 120
+
+// CardStatements agrupa los gastos de una tarjeta por resumen. Cada resumen
+// incluye las compras posteriores al cierre anterior hasta su fecha de
+// cierre, y se debita en su fecha de vencimiento. Los parámetros from y to
+// (YYYY-MM) indican los meses de cierre; por defecto se devuelven los últimos
+// 12 resúmenes hasta el que está abierto hoy.
+func (h *Handler) CardStatements(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	cardID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la tarjeta no es válido", err)
+		return
+	}
+
+	card, err := scanAccount(h.DB.QueryRow(
+		`SELECT `+accountColumns+` FROM accounts WHERE id=$1 AND user_id=$2`, cardID, userID,
+	))
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "No se encontró la tarjeta solicitada", nil)
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la tarjeta", err)
+		return
+	}
+	if card.Type != models.AccountCreditCard {
+		respondValidationError(c, "La cuenta indicada no es una tarjeta de crédito", nil)
+		return
+	}
+	if !card.HasStatementCycle() {
+		respondValidationError(c, "La tarjeta no tiene configurados el día de cierre y el de vencimiento", nil)
+		return
+	}
+
+	current := card.StatementClosing(time.Now())
+	to := time.Date(current.Year(), current.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, -11, 0)
+	if toParam := c.Query("to"); toParam != "" {
+		month, err := parseMonth(toParam)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'to' debe usar el formato YYYY-MM", err)
+			return
+		}
+		to = month
+		from = to.AddDate(0, -11, 0)
+	}
+	if fromParam := c.Query("from"); fromParam != "" {
+		month, err := parseMonth(fromParam)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'from' debe usar el formato YYYY-MM", err)
+			return
+		}
+		from = month
+	}
+	if to.Before(from) {
+		respondValidationError(c, "El parámetro 'to' no puede ser anterior a 'from'", nil)
+		return
+	}
+	if cycles := (to.Year()-from.Year())*12 + int(to.Month()-from.Month()) + 1; cycles > maxStatementCycles {
+		respondValidationError(c, fmt.Sprintf("El rango no puede superar los %d resúmenes", maxStatementCycles), nil)
+		return
+	}
+
+	// El primer resumen arranca el día siguiente al cierre del mes anterior.
+	start := card.ClosingDateIn(from.AddDate(0, -1, 0))
+	end := card.ClosingDateIn(to)
+	rows, err := h.DB.Query(
+		`SELECT expense_date, currency, SUM(amount), COUNT(*)
+		 FROM expenses
+		 WHERE user_id=$1 AND account_id=$2 AND expense_date > $3 AND expense_date <= $4
+		 GROUP BY expense_date, currency
+		 ORDER BY expense_date`,
+		userID, card.ID, start.Format("2006-01-02"), end.Format("2006-01-02"),
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron calcular los resúmenes de la tarjeta", err)
+		return
+	}
+	defer rows.Close()
+
+	byClosing := map[string]*models.Statement{}
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		closing := card.ClosingDateIn(month)
+		byClosing[closing.Format("2006-01-02")] = &models.Statement{
+			ClosingDate: closing.Format("2006-01-02"),
+			DueDate:     card.StatementDue(closing).Format("2006-01-02"),
+		}
+	}
+	for rows.Next() {
+		var date time.Time
+		var currency string
+		var total models.Money
+		var count int64
+		if err := rows.Scan(&date, &currency, &total, &count); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudieron leer los resúmenes de la tarjeta", err)
+			return
+		}
+		statement, ok := byClosing[card.StatementClosing(date).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		statement.Expenses += count
+		if currency == card.Currency {
+			statement.Total += total
+			continue
+		}
+		if statement.Foreign == nil {
+			statement.Foreign = map[string]models.Money{}
+		}
+		statement.Foreign[currency] += total
+	}
+
+	statements := []models.Statement{}
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		statements = append(statements, *byClosing[card.ClosingDateIn(month).Format("2006-01-02")])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"card":       card,
+		"statements": statements,
+	})
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCardStatements(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/cards/:id/statements", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CardStatements(c)
+	})
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM accounts WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(3), int64(1)).
+		WillReturnRows(sqlmock.NewRows(accountColumnNames).
+			AddRow(3, 1, "Visa", "credit_card", "ARS", "0", 25, 8, createdAt))
+	mock.ExpectQuery(`FROM expenses\s+WHERE user_id=\$1 AND account_id=\$2 AND expense_date > \$3 AND expense_date <= \$4\s+GROUP BY expense_date, currency`).
+		WithArgs(int64(1), int64(3), "2024-01-25", "2024-03-25").
+		WillReturnRows(sqlmock.NewRows([]string{"expense_date", "currency", "sum", "count"}).
+			AddRow(time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC), "ARS", "1500.00", 2).
+			AddRow(time.Date(2024, 2, 25, 0, 0, 0, 0, time.UTC), "USD", "20.00", 1).
+			AddRow(time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), "ARS", "300.50", 1))
+
+	req, _ := http.NewRequest("GET", "/cards/3/statements?from=2024-02&to=2024-03", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(),
+		`{"closingDate":"2024-02-25","dueDate":"2024-03-08","total":1500.00,"expenses":3,"foreign":{"USD":20.00}}`)
+	assert.Contains(t, w.Body.String(),
+		`{"closingDate":"2024-03-25","dueDate":"2024-04-08","total":300.50,"expenses":1}`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCardStatements_NotACard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/cards/:id/statements", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CardStatements(c)
+	})
+
+	mock.ExpectQuery(`FROM accounts WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(2), int64(1)).
+		WillReturnRows(sqlmock.NewRows(accountColumnNames).
+			AddRow(2, 1, "Banco", "bank", "ARS", "0", nil, nil, time.Now()))
+
+	req, _ := http.NewRequest("GET", "/cards/2/statements", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "no es una tarjeta de crédito")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
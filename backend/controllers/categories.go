@@ -0,0 +1,483 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+const categoryColumns = `id, user_id, name, color, icon, parent_id, created_at`
+
+// categoryColorPattern acepta colores hexadecimales como #1E88E5.
+var categoryColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+func scanCategory(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.Category, error) {
+	var category models.Category
+	var parentID sql.NullInt64
+	dest := append([]interface{}{&category.ID, &category.UserID, &category.Name, &category.Color, &category.Icon,
+		&parentID, &category.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return category, err
+	}
+	if parentID.Valid {
+		id := parentID.Int64
+		category.ParentID = &id
+	}
+	return category, nil
+}
+
+// normalizeCategoryName quita los espacios de los extremos y deja uno solo
+// entre palabras. Junto con el índice sobre lower(name), hace que "Comida" y
+// "comida " sean la misma categoría.
+func normalizeCategoryName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// bindCategory resuelve la etiqueta de un gasto, plantilla o presupuesto a su
+// categoría, creándola si no existe, y devuelve el nombre con el que está
+// guardada. q debe ser la transacción de la escritura que usa la etiqueta,
+// para que la categoría no quede creada si esa escritura falla. Si la
+// etiqueta queda vacía responde 400 y devuelve false.
+func bindCategory(c *gin.Context, q queryer, userID int64, tag string) (string, bool) {
+	name := normalizeCategoryName(tag)
+	if name == "" {
+		respondValidationError(c, "La etiqueta no puede estar vacía", nil)
+		return "", false
+	}
+	err := q.QueryRowContext(c,
+		`INSERT INTO categories (user_id, name) VALUES ($1, $2)
+		 ON CONFLICT (user_id, lower(name)) DO UPDATE SET name = categories.name
+		 RETURNING name`,
+		userID, name,
+	).Scan(&name)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo registrar la categoría", err)
+		return "", false
+	}
+	return name, true
+}
+
+// checkCategoryParent verifica que parentID sea una categoría del usuario y
+// que no sea categoryID ni una de sus descendientes, para que el árbol no
+// tenga ciclos. Al crear una categoría, categoryID es 0. Si el padre no es
+// válido responde 400 y devuelve false.
+func checkCategoryParent(c *gin.Context, q queryer, userID, categoryID, parentID int64) bool {
+	var exists, descendant bool
+	err := q.QueryRowContext(c,
+		`WITH RECURSIVE descendants AS (
+			SELECT id FROM categories WHERE id=$1
+			UNION
+			SELECT child.id FROM categories child JOIN descendants d ON child.parent_id = d.id
+		 )
+		 SELECT EXISTS (SELECT 1 FROM categories WHERE id=$2 AND user_id=$3),
+			EXISTS (SELECT 1 FROM descendants WHERE id=$2)`,
+		categoryID, parentID, userID,
+	).Scan(&exists, &descendant)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo verificar la categoría padre", err)
+		return false
+	}
+	if !exists {
+		respondValidationError(c, "La categoría padre no existe", nil)
+		return false
+	}
+	if descendant {
+		respondValidationError(c, "Una categoría no puede quedar dentro de sí misma ni de sus subcategorías", nil)
+		return false
+	}
+	return true
+}
+
+// validCategoryStyle valida el color y el ícono. Si no son válidos responde
+// 400 y devuelve false.
+func validCategoryStyle(c *gin.Context, color, icon *string) bool {
+	if color != nil && *color != "" && !categoryColorPattern.MatchString(*color) {
+		respondValidationError(c, "El color debe tener el formato #RRGGBB", nil)
+		return false
+	}
+	if icon != nil && len([]rune(*icon)) > 32 {
+		respondValidationError(c, "El ícono no puede superar los 32 caracteres", nil)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) ListCategories(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	rows, err := h.DB.Query(`SELECT `+categoryColumns+` FROM categories WHERE user_id=$1 ORDER BY lower(name)`, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de categorías", err)
+		return
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de categorías", err)
+			return
+		}
+		categories = append(categories, category)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+func (h *Handler) CreateCategory(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	var req struct {
+		Name     string `json:"name" binding:"required"`
+		Color    string `json:"color"`
+		Icon     string `json:"icon"`
+		ParentID *int64 `json:"parentId" binding:"omitempty,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de la categoría no son válidos", err)
+		return
+	}
+	name := normalizeCategoryName(req.Name)
+	if name == "" {
+		respondValidationError(c, "El nombre de la categoría no puede estar vacío", nil)
+		return
+	}
+	if !validCategoryStyle(c, &req.Color, &req.Icon) {
+		return
+	}
+	if req.ParentID != nil && !checkCategoryParent(c, h.DB, userID, 0, *req.ParentID) {
+		return
+	}
+
+	category, err := scanCategory(h.DB.QueryRow(
+		`INSERT INTO categories (user_id, name, color, icon, parent_id)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING `+categoryColumns,
+		userID, name, req.Color, req.Icon, req.ParentID,
+	))
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondError(c, http.StatusBadRequest, "Ya existe una categoría con ese nombre", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo guardar la categoría", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"category": category})
+}
+
+// UpdateCategory cambia el color, el ícono, el nombre o la categoría padre. Al
+// renombrarla, en la misma transacción se actualizan los gastos, plantillas,
+// compras en cuotas y presupuestos que la usan.
+func (h *Handler) UpdateCategory(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	categoryID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la categoría no es válido", err)
+		return
+	}
+
+	var req struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+		Icon  *string `json:"icon"`
+		// Un 0 la deja en el primer nivel.
+		ParentID *int64 `json:"parentId" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de la categoría no son válidos", err)
+		return
+	}
+	if !validCategoryStyle(c, req.Color, req.Icon) {
+		return
+	}
+
+	var set updateSet
+	if req.Name != nil {
+		name := normalizeCategoryName(*req.Name)
+		if name == "" {
+			respondValidationError(c, "El nombre de la categoría no puede estar vacío", nil)
+			return
+		}
+		set.add("name", name)
+	}
+	if req.Color != nil {
+		set.add("color", *req.Color)
+	}
+	if req.Icon != nil {
+		set.add("icon", *req.Icon)
+	}
+	if req.ParentID != nil {
+		if *req.ParentID == 0 {
+			set.add("parent_id", nil)
+		} else {
+			set.add("parent_id", *req.ParentID)
+		}
+	}
+	if set.empty() {
+		respondValidationError(c, "No se enviaron campos para actualizar", nil)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la actualización de la categoría", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRowContext(c,
+		`SELECT name FROM categories WHERE id=$1 AND user_id=$2 FOR UPDATE`, categoryID, userID,
+	).Scan(&oldName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró la categoría solicitada", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo recuperar la categoría", err)
+		return
+	}
+	if req.ParentID != nil && *req.ParentID != 0 && !checkCategoryParent(c, tx, userID, categoryID, *req.ParentID) {
+		return
+	}
+
+	category, err := scanCategory(tx.QueryRowContext(c,
+		fmt.Sprintf(
+			`UPDATE categories
+			 SET %s
+			 WHERE id=$%d AND user_id=$%d
+			 RETURNING `+categoryColumns,
+			set.clause(), set.next(), set.next()+1,
+		),
+		set.argsWith(categoryID, userID)...,
+	))
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondError(c, http.StatusBadRequest, "Ya existe una categoría con ese nombre", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar la categoría", err)
+		return
+	}
+
+	var expenses, templates int64
+	if category.Name != oldName {
+		expenses, templates, err = retagCategory(c, tx, userID, oldName, category.Name)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudieron actualizar los gastos de la categoría", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la actualización de la categoría", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"category":        category,
+		"expenses":        expenses,
+		"monthlyExpenses": templates,
+	})
+}
+
+// MergeCategory pasa todo lo que usa la categoría :id a la categoría "into",
+// incluidas sus subcategorías y reglas, y después la elimina, en una sola
+// transacción.
+// Si ambas tenían presupuesto se conserva el de la categoría destino.
+func (h *Handler) MergeCategory(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	sourceID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la categoría no es válido", err)
+		return
+	}
+
+	var req struct {
+		Into int64 `json:"into" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Hay que indicar en 'into' la categoría destino", err)
+		return
+	}
+	if req.Into == sourceID {
+		respondValidationError(c, "No se puede fusionar una categoría consigo misma", nil)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la fusión de categorías", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var target models.Category
+	source, err := scanCategory(tx.QueryRowContext(c,
+		`SELECT `+categoryColumns+` FROM categories WHERE id=$1 AND user_id=$2 FOR UPDATE`, sourceID, userID,
+	))
+	if err == nil {
+		target, err = scanCategory(tx.QueryRowContext(c,
+			`SELECT `+categoryColumns+` FROM categories WHERE id=$1 AND user_id=$2 FOR UPDATE`, req.Into, userID,
+		))
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró la categoría solicitada", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudieron recuperar las categorías", err)
+		return
+	}
+
+	expenses, templates, err := retagCategory(c, tx, userID, source.Name, target.Name)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron mover los gastos a la categoría destino", err)
+		return
+	}
+
+	// Si la destino estaba debajo de la fusionada, primero sube a su lugar
+	// para que mover las subcategorías no forme un ciclo.
+	result, err := tx.ExecContext(c,
+		`WITH RECURSIVE descendants AS (
+			SELECT id FROM categories WHERE parent_id=$1
+			UNION
+			SELECT child.id FROM categories child JOIN descendants d ON child.parent_id = d.id
+		 )
+		 UPDATE categories SET parent_id=$2
+		 WHERE id=$3 AND id IN (SELECT id FROM descendants)`,
+		source.ID, source.ParentID, target.ID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo reubicar la categoría destino", err)
+		return
+	}
+	moved, err := result.RowsAffected()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo reubicar la categoría destino", err)
+		return
+	}
+	if moved > 0 {
+		target.ParentID = source.ParentID
+	}
+	if _, err := tx.ExecContext(c,
+		`UPDATE categories SET parent_id=$1 WHERE parent_id=$2 AND user_id=$3`, target.ID, source.ID, userID,
+	); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron mover las subcategorías", err)
+		return
+	}
+	if _, err := tx.ExecContext(c,
+		`UPDATE categorization_rules SET category_id=$1 WHERE category_id=$2 AND user_id=$3`, target.ID, source.ID, userID,
+	); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron mover las reglas de categorización", err)
+		return
+	}
+	if _, err := tx.ExecContext(c, `DELETE FROM categories WHERE id=$1 AND user_id=$2`, source.ID, userID); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo eliminar la categoría fusionada", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la fusión de categorías", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"category":        target,
+		"expenses":        expenses,
+		"monthlyExpenses": templates,
+	})
+}
+
+// DeleteCategory elimina una categoría que no esté en uso, junto con sus
+// reglas de categorización. Las que se usan tienen que fusionarse con otra.
+func (h *Handler) DeleteCategory(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	categoryID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la categoría no es válido", err)
+		return
+	}
+
+	var inUse bool
+	err = h.DB.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM expenses WHERE user_id=$2 AND tag=c.name)
+			OR EXISTS (SELECT 1 FROM monthly_expenses WHERE user_id=$2 AND tag=c.name)
+			OR EXISTS (SELECT 1 FROM installment_plans WHERE user_id=$2 AND tag=c.name)
+			OR EXISTS (SELECT 1 FROM budgets WHERE user_id=$2 AND tag=c.name)
+		 FROM categories c
+		 WHERE c.id=$1 AND c.user_id=$2`,
+		categoryID, userID,
+	).Scan(&inUse)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "No se encontró la categoría solicitada", nil)
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo verificar si la categoría está en uso", err)
+		return
+	}
+	if inUse {
+		respondError(c, http.StatusBadRequest, "La categoría está en uso; se puede fusionar con otra en lugar de eliminarla", nil)
+		return
+	}
+
+	if _, err := h.DB.Exec(`DELETE FROM categories WHERE id=$1 AND user_id=$2`, categoryID, userID); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo eliminar la categoría", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// retagCategory reemplaza la etiqueta from por to en los gastos, plantillas,
+// compras en cuotas y presupuestos del usuario. Si ya había un presupuesto
+// para to, el de from se descarta. Devuelve cuántos gastos y plantillas cambiaron.
+func retagCategory(ctx context.Context, tx *sql.Tx, userID int64, from, to string) (int64, int64, error) {
+	result, err := tx.ExecContext(ctx, `UPDATE expenses SET tag=$1 WHERE user_id=$2 AND tag=$3`, to, userID, from)
+	if err != nil {
+		return 0, 0, err
+	}
+	expenses, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	result, err = tx.ExecContext(ctx, `UPDATE monthly_expenses SET tag=$1 WHERE user_id=$2 AND tag=$3`, to, userID, from)
+	if err != nil {
+		return 0, 0, err
+	}
+	templates, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE installment_plans SET tag=$1 WHERE user_id=$2 AND tag=$3`, to, userID, from); err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM budgets
+		 WHERE user_id=$2 AND tag=$3
+			AND EXISTS (SELECT 1 FROM budgets other WHERE other.user_id=$2 AND other.tag=$1)`,
+		to, userID, from,
+	); err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE budgets SET tag=$1 WHERE user_id=$2 AND tag=$3`, to, userID, from); err != nil {
+		return 0, 0, err
+	}
+
+	return expenses, templates, nil
+}
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
+)
+
+// categoryColumnNames are the columns returned by queries selecting categoryColumns.
+var categoryColumnNames = strings.Split(categoryColumns, ", ")
+
+// expectCategory expects the upsert that resolves tag to an existing category.
+func expectCategory(mock sqlmock.Sqlmock, userID int64, tag string) {
+	mock.ExpectQuery("INSERT INTO categories").
+		WithArgs(userID, tag).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(tag))
+}
+
+func TestNormalizeCategoryName(t *testing.T) {
+	assert.Equal(t, "Comida", normalizeCategoryName("  Comida "))
+	assert.Equal(t, "Comida rápida", normalizeCategoryName("Comida \t rápida"))
+	assert.Equal(t, "", normalizeCategoryName("   "))
+}
+
+func TestCreateExpense_UsesCategoryName(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateExpense(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO categories \(user_id, name\) VALUES \(\$1, \$2\)\s+ON CONFLICT \(user_id, lower\(name\)\)`).
+		WithArgs(int64(1), "comida").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Comida"))
+	mock.ExpectQuery("INSERT INTO expenses").
+		WithArgs(int64(1), "Almuerzo", "Comida", models.Money(150000), sqlmock.AnyArg(), nil, nil).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(1, 1, "Almuerzo", "Comida", "1500.00", time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectCommit()
+
+	body := `{"name": "Almuerzo", "tag": " comida ", "amount": 1500, "date": "2024-03-10"}`
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"tag":"Comida"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateCategory_RenameRetagsExpenses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/categories/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateCategory(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT name FROM categories WHERE id=\$1 AND user_id=\$2 FOR UPDATE`).
+		WithArgs(int64(5), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Food"))
+	mock.ExpectQuery(`UPDATE categories\s+SET name=\$1\s+WHERE id=\$2 AND user_id=\$3`).
+		WithArgs("Comida", int64(5), int64(1)).
+		WillReturnRows(sqlmock.NewRows(categoryColumnNames).AddRow(5, 1, "Comida", "#E53935", "", nil, time.Now()))
+	mock.ExpectExec(`UPDATE expenses SET tag=\$1 WHERE user_id=\$2 AND tag=\$3`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 12))
+	mock.ExpectExec(`UPDATE monthly_expenses SET tag=\$1`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE installment_plans SET tag=\$1`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM budgets`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE budgets SET tag=\$1`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	body := `{"name": "Comida"}`
+	req, _ := http.NewRequest("PATCH", "/categories/5", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Comida"`)
+	assert.Contains(t, w.Body.String(), `"expenses":12`)
+	assert.Contains(t, w.Body.String(), `"monthlyExpenses":1`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeCategory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/categories/:id/merge", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.MergeCategory(c)
+	})
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM categories WHERE id=\$1 AND user_id=\$2 FOR UPDATE`).
+		WithArgs(int64(7), int64(1)).
+		WillReturnRows(sqlmock.NewRows(categoryColumnNames).AddRow(7, 1, "Food", "", "", nil, now))
+	mock.ExpectQuery(`FROM categories WHERE id=\$1 AND user_id=\$2 FOR UPDATE`).
+		WithArgs(int64(5), int64(1)).
+		WillReturnRows(sqlmock.NewRows(categoryColumnNames).AddRow(5, 1, "Comida", "#E53935", "🍔", nil, now))
+	mock.ExpectExec(`UPDATE expenses SET tag=\$1`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`UPDATE monthly_expenses SET tag=\$1`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE installment_plans SET tag=\$1`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM budgets\s+WHERE user_id=\$2 AND tag=\$3\s+AND EXISTS`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE budgets SET tag=\$1`).
+		WithArgs("Comida", int64(1), "Food").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE categories SET parent_id=\$2\s+WHERE id=\$3 AND id IN \(SELECT id FROM descendants\)`).
+		WithArgs(int64(7), nil, int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE categories SET parent_id=\$1 WHERE parent_id=\$2 AND user_id=\$3`).
+		WithArgs(int64(5), int64(7), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE categorization_rules SET category_id=\$1 WHERE category_id=\$2 AND user_id=\$3`).
+		WithArgs(int64(5), int64(7), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM categories WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(7), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	body := `{"into": 5}`
+	req, _ := http.NewRequest("POST", "/categories/7/merge", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Comida"`)
+	assert.Contains(t, w.Body.String(), `"expenses":3`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteCategory_InUse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.DELETE("/categories/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.DeleteCategory(c)
+	})
+
+	mock.ExpectQuery(`FROM categories c\s+WHERE c.id=\$1 AND c.user_id=\$2`).
+		WithArgs(int64(5), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"in_use"}).AddRow(true))
+
+	req, _ := http.NewRequest("DELETE", "/categories/5", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "La categoría está en uso")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateCategory_RejectsDescendantAsParent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/categories/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateCategory(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT name FROM categories WHERE id=\$1 AND user_id=\$2 FOR UPDATE`).
+		WithArgs(int64(2), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Hogar"))
+	mock.ExpectQuery(`WITH RECURSIVE descendants AS`).
+		WithArgs(int64(2), int64(9), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists", "descendant"}).AddRow(true, true))
+	mock.ExpectRollback()
+
+	body := `{"parentId": 9}`
+	req, _ := http.NewRequest("PATCH", "/categories/2", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "no puede quedar dentro de sí misma")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
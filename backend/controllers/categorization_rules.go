@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"gestor-gastos/models"
+)
+
+// ruleColumns incluye el nombre de la categoría, por lo que las consultas
+// tienen que unir categorization_rules r con categories c.
+const ruleColumns = `r.id, r.user_id, r.priority, r.name_contains, r.name_pattern, r.min_amount, r.max_amount,
+	r.currency, r.category_id, c.name, r.created_at`
+
+// ruleConditionsMessage es el error que se devuelve cuando las condiciones de
+// una regla no son válidas.
+const ruleConditionsMessage = "La regla necesita al menos una condición y el monto mínimo no puede superar al máximo"
+
+func scanRule(row interface{ Scan(...interface{}) error }) (models.CategorizationRule, error) {
+	var rule models.CategorizationRule
+	err := row.Scan(&rule.ID, &rule.UserID, &rule.Priority, &rule.NameContains, &rule.NamePattern,
+		&rule.MinAmount, &rule.MaxAmount, &rule.Currency, &rule.CategoryID, &rule.Tag, &rule.CreatedAt)
+	return rule, err
+}
+
+// validRulePattern verifica que la expresión regular compile. Si no compila
+// responde 400 y devuelve false.
+func validRulePattern(c *gin.Context, pattern string) bool {
+	if _, err := regexp.Compile(pattern); err != nil {
+		respondValidationError(c, "La expresión regular de la regla no es válida", err)
+		return false
+	}
+	return true
+}
+
+// loadRules devuelve las reglas del usuario en el orden en que se evalúan.
+func loadRules(ctx context.Context, q queryer, userID int64) ([]models.CategorizationRule, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT `+ruleColumns+`
+		 FROM categorization_rules r JOIN categories c ON c.id = r.category_id
+		 WHERE r.user_id=$1
+		 ORDER BY r.priority, r.id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.CategorizationRule{}
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// categorizeExpense busca la primera regla que coincide con un gasto sin
+// etiqueta. Si currency es nil el gasto queda en la moneda base del usuario.
+// Devuelve nil si ninguna coincide; si falla la consulta responde 500 y
+// devuelve false.
+func (h *Handler) categorizeExpense(c *gin.Context, userID int64, name string, amount models.Money, currency *string) (*models.CategorizationRule, bool) {
+	rules, err := loadRules(c, h.DB, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron obtener las reglas de categorización", err)
+		return nil, false
+	}
+	if currency == nil {
+		var base string
+		if err := h.DB.QueryRowContext(c, `SELECT base_currency FROM users WHERE id=$1`, userID).Scan(&base); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo obtener la moneda base", err)
+			return nil, false
+		}
+		currency = &base
+	}
+	return models.NewRuleSet(rules).Match(name, amount, *currency), true
+}
+
+func (h *Handler) ListCategorizationRules(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	rules, err := loadRules(c, h.DB, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de reglas de categorización", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func (h *Handler) CreateCategorizationRule(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	var req struct {
+		// Priority ordena la evaluación: primero las de menor número.
+		Priority     int           `json:"priority" binding:"min=0,max=1000000"`
+		NameContains string        `json:"nameContains"`
+		NamePattern  string        `json:"namePattern"`
+		MinAmount    *models.Money `json:"minAmount" binding:"omitempty,gt=0"`
+		MaxAmount    *models.Money `json:"maxAmount" binding:"omitempty,gt=0"`
+		// Currency es la moneda de MinAmount y MaxAmount; por defecto, la
+		// moneda base del usuario.
+		Currency   string `json:"currency"`
+		CategoryID int64  `json:"categoryId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de la regla no son válidos", err)
+		return
+	}
+	req.NameContains = strings.TrimSpace(req.NameContains)
+	req.NamePattern = strings.TrimSpace(req.NamePattern)
+	if req.NameContains == "" && req.NamePattern == "" && req.MinAmount == nil && req.MaxAmount == nil ||
+		req.MinAmount != nil && req.MaxAmount != nil && *req.MinAmount > *req.MaxAmount {
+		respondValidationError(c, ruleConditionsMessage, nil)
+		return
+	}
+	if !validRulePattern(c, req.NamePattern) {
+		return
+	}
+	currency, ok := bindCurrency(c, req.Currency)
+	if !ok {
+		return
+	}
+
+	// El INSERT toma la categoría de categories, así que si no es del usuario
+	// no se inserta nada.
+	rule, err := scanRule(h.DB.QueryRow(
+		`WITH r AS (
+			INSERT INTO categorization_rules (user_id, priority, name_contains, name_pattern, min_amount, max_amount, currency, category_id)
+			SELECT $1, $2, $3, $4, $5, $6, COALESCE($8, (SELECT base_currency FROM users WHERE id=$1)), id
+			FROM categories WHERE id=$7 AND user_id=$1
+			RETURNING *
+		 )
+		 SELECT `+ruleColumns+` FROM r JOIN categories c ON c.id = r.category_id`,
+		userID, req.Priority, req.NameContains, req.NamePattern, req.MinAmount, req.MaxAmount, req.CategoryID, currency,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondValidationError(c, "La categoría indicada no existe", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo guardar la regla", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"rule": rule})
+}
+
+// UpdateCategorizationRule actualiza los campos enviados. Un texto vacío quita
+// la condición por nombre y un monto 0 quita ese límite.
+func (h *Handler) UpdateCategorizationRule(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	ruleID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la regla no es válido", err)
+		return
+	}
+
+	var req struct {
+		Priority     *int          `json:"priority" binding:"omitempty,min=0,max=1000000"`
+		NameContains *string       `json:"nameContains"`
+		NamePattern  *string       `json:"namePattern"`
+		MinAmount    *models.Money `json:"minAmount" binding:"omitempty,min=0"`
+		MaxAmount    *models.Money `json:"maxAmount" binding:"omitempty,min=0"`
+		Currency     *string       `json:"currency"`
+		CategoryID   *int64        `json:"categoryId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de la regla no son válidos", err)
+		return
+	}
+
+	var set updateSet
+	if req.Priority != nil {
+		set.add("priority", *req.Priority)
+	}
+	if req.NameContains != nil {
+		set.add("name_contains", strings.TrimSpace(*req.NameContains))
+	}
+	if req.NamePattern != nil {
+		pattern := strings.TrimSpace(*req.NamePattern)
+		if !validRulePattern(c, pattern) {
+			return
+		}
+		set.add("name_pattern", pattern)
+	}
+	if req.MinAmount != nil {
+		set.add("min_amount", nullableMoney(*req.MinAmount))
+	}
+	if req.MaxAmount != nil {
+		set.add("max_amount", nullableMoney(*req.MaxAmount))
+	}
+	if req.Currency != nil {
+		currency, ok := bindCurrency(c, *req.Currency)
+		if !ok {
+			return
+		}
+		if currency != nil {
+			set.add("currency", *currency)
+		}
+	}
+	if req.CategoryID != nil {
+		set.add("category_id", *req.CategoryID)
+	}
+	if set.empty() {
+		respondValidationError(c, "No se enviaron campos para actualizar", nil)
+		return
+	}
+	if req.CategoryID != nil {
+		var exists bool
+		err := h.DB.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM categories WHERE id=$1 AND user_id=$2)`, *req.CategoryID, userID,
+		).Scan(&exists)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo verificar la categoría", err)
+			return
+		}
+		if !exists {
+			respondValidationError(c, "La categoría indicada no existe", nil)
+			return
+		}
+	}
+
+	rule, err := scanRule(h.DB.QueryRow(
+		fmt.Sprintf(
+			`WITH r AS (
+				UPDATE categorization_rules
+				SET %s
+				WHERE id=$%d AND user_id=$%d
+				RETURNING *
+			 )
+			 SELECT `+ruleColumns+` FROM r JOIN categories c ON c.id = r.category_id`,
+			set.clause(), set.next(), set.next()+1,
+		),
+		set.argsWith(ruleID, userID)...,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró la regla solicitada", nil)
+			return
+		}
+		if isCheckViolation(err) {
+			respondValidationError(c, ruleConditionsMessage, nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar la regla", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rule": rule})
+}
+
+func (h *Handler) DeleteCategorizationRule(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	ruleID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la regla no es válido", err)
+		return
+	}
+
+	result, err := h.DB.Exec(`DELETE FROM categorization_rules WHERE id=$1 AND user_id=$2`, ruleID, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo eliminar la regla", err)
+		return
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la eliminación de la regla", err)
+		return
+	}
+	if rows == 0 {
+		respondError(c, http.StatusNotFound, "No se encontró la regla solicitada", nil)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PreviewCategorizationRules informa cuántos gastos sin etiqueta cambiaría
+// cada regla, sin modificar nada.
+func (h *Handler) PreviewCategorizationRules(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	counts, unmatched, _, err := matchUncategorized(c, h.DB, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron evaluar las reglas de categorización", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": counts, "unmatched": unmatched})
+}
+
+// ApplyCategorizationRules vuelve a evaluar las reglas sobre los gastos sin
+// etiqueta y les asigna la categoría de la primera que coincide. El UPDATE
+// vuelve a exigir tag vacío para no pisar gastos categorizados mientras tanto.
+func (h *Handler) ApplyCategorizationRules(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la categorización", err)
+		return
+	}
+	defer tx.Rollback()
+
+	counts, unmatched, matches, err := matchUncategorized(c, tx, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron evaluar las reglas de categorización", err)
+		return
+	}
+	for _, count := range counts {
+		if count.Expenses == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(c,
+			`UPDATE expenses SET tag=$1 WHERE user_id=$2 AND id = ANY($3) AND tag=''`,
+			count.Tag, userID, pq.Array(matches[count.RuleID]),
+		); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudieron categorizar los gastos", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la categorización", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": counts, "unmatched": unmatched})
+}
+
+// matchUncategorized evalúa las reglas sobre los gastos sin etiqueta. Devuelve
+// cuántos toma cada regla, en orden de evaluación, cuántos no coinciden con
+// ninguna y los ids de los gastos que corresponden a cada regla.
+func matchUncategorized(ctx context.Context, q queryer, userID int64) ([]models.RuleMatchCount, int64, map[int64][]int64, error) {
+	rules, err := loadRules(ctx, q, userID)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	rows, err := q.QueryContext(ctx,
+		`SELECT id, name, amount, currency FROM expenses WHERE user_id=$1 AND tag='' ORDER BY id`, userID,
+	)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer rows.Close()
+
+	set := models.NewRuleSet(rules)
+	matches := map[int64][]int64{}
+	var unmatched int64
+	for rows.Next() {
+		var id int64
+		var name, currency string
+		var amount models.Money
+		if err := rows.Scan(&id, &name, &amount, &currency); err != nil {
+			return nil, 0, nil, err
+		}
+		rule := set.Match(name, amount, currency)
+		if rule == nil {
+			unmatched++
+			continue
+		}
+		matches[rule.ID] = append(matches[rule.ID], id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, nil, err
+	}
+
+	counts := make([]models.RuleMatchCount, 0, len(rules))
+	for _, rule := range rules {
+		counts = append(counts, models.RuleMatchCount{
+			RuleID:   rule.ID,
+			Tag:      rule.Tag,
+			Expenses: int64(len(matches[rule.ID])),
+		})
+	}
+	return counts, unmatched, matches, nil
+}
@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
+)
+
+// ruleColumnNames are the columns returned by queries selecting ruleColumns.
+var ruleColumnNames = []string{"id", "user_id", "priority", "name_contains", "name_pattern", "min_amount", "max_amount",
+	"currency", "category_id", "name", "created_at"}
+
+func ruleRows() *sqlmock.Rows {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return sqlmock.NewRows(ruleColumnNames).
+		AddRow(1, 1, 1, "uber", "", nil, nil, "ARS", 4, "Transporte", createdAt).
+		AddRow(2, 1, 2, "", `^(Coto|Dia)\b`, nil, nil, "ARS", 5, "Supermercado", createdAt)
+}
+
+func TestCreateExpense_AppliesCategorizationRule(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateExpense(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM categorization_rules r JOIN categories c ON c.id = r.category_id\s+WHERE r.user_id=\$1\s+ORDER BY r.priority, r.id`).
+		WithArgs(int64(1)).
+		WillReturnRows(ruleRows())
+	mock.ExpectQuery(`SELECT base_currency FROM users WHERE id=\$1`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("ARS"))
+	mock.ExpectQuery("INSERT INTO expenses").
+		WithArgs(int64(1), "Coto Palermo", "Supermercado", models.Money(2500000), sqlmock.AnyArg(), nil, nil).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(1, 1, "Coto Palermo", "Supermercado", "25000.00", time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectCommit()
+
+	body := `{"name": "Coto Palermo", "amount": 25000, "date": "2024-03-10"}`
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"tag":"Supermercado"`)
+	assert.Contains(t, w.Body.String(), `"ruleId":2`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateExpense_NoRuleMatchesLeavesUncategorised(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateExpense(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM categorization_rules r`).
+		WithArgs(int64(1)).
+		WillReturnRows(ruleRows())
+	mock.ExpectQuery(`SELECT base_currency FROM users WHERE id=\$1`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("ARS"))
+	mock.ExpectQuery("INSERT INTO expenses").
+		WithArgs(int64(1), "Kiosco", "", models.Money(150000), sqlmock.AnyArg(), nil, nil).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(1, 1, "Kiosco", "", "1500.00", time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectCommit()
+
+	body := `{"name": "Kiosco", "tag": "  ", "amount": 1500, "date": "2024-03-10"}`
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "ruleId")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateCategorizationRule_InvalidPattern(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/categorization-rules", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateCategorizationRule(c)
+	})
+
+	for body, message := range map[string]string{
+		`{"namePattern": "(Coto", "categoryId": 5}`:                   "La expresión regular de la regla no es válida",
+		`{"categoryId": 5}`:                                           "al menos una condición",
+		`{"minAmount": 5000, "maxAmount": 100, "categoryId": 5}`:      "el monto mínimo no puede superar al máximo",
+		`{"nameContains": "   ", "namePattern": "", "categoryId": 5}`: "al menos una condición",
+		`{"namePattern": "  ", "categoryId": 5}`:                      "al menos una condición",
+		`{"nameContains": "uber", "priority": -1, "categoryId": 5}`:   "Los datos de la regla no son válidos",
+		`{"minAmount": 100, "currency": "pesos", "categoryId": 5}`:    "La moneda debe ser un código ISO",
+	} {
+		req, _ := http.NewRequest("POST", "/categorization-rules", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Contains(t, w.Body.String(), message, body)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPreviewCategorizationRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/categorization-rules/preview", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.PreviewCategorizationRules(c)
+	})
+
+	mock.ExpectQuery(`FROM categorization_rules r`).
+		WithArgs(int64(1)).
+		WillReturnRows(ruleRows())
+	mock.ExpectQuery(`SELECT id, name, amount, currency FROM expenses WHERE user_id=\$1 AND tag=''`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "amount", "currency"}).
+			AddRow(10, "Uber al centro", "3500.00", "ARS").
+			AddRow(11, "Coto Palermo", "25000.00", "ARS").
+			AddRow(12, "Dia Belgrano", "8000.00", "ARS").
+			AddRow(13, "Kiosco", "1500.00", "ARS"))
+
+	req, _ := http.NewRequest("GET", "/categorization-rules/preview", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"rules": [
+			{"ruleId": 1, "tag": "Transporte", "expenses": 1},
+			{"ruleId": 2, "tag": "Supermercado", "expenses": 2}
+		],
+		"unmatched": 1
+	}`, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyCategorizationRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/categorization-rules/apply", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ApplyCategorizationRules(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM categorization_rules r`).
+		WithArgs(int64(1)).
+		WillReturnRows(ruleRows())
+	mock.ExpectQuery(`SELECT id, name, amount, currency FROM expenses WHERE user_id=\$1 AND tag=''`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "amount", "currency"}).
+			AddRow(11, "Coto Palermo", "25000.00", "ARS").
+			AddRow(12, "Dia Belgrano", "8000.00", "ARS"))
+	mock.ExpectExec(`UPDATE expenses SET tag=\$1 WHERE user_id=\$2 AND id = ANY\(\$3\) AND tag=''`).
+		WithArgs("Supermercado", int64(1), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest("POST", "/categorization-rules/apply", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `{"ruleId":2,"tag":"Supermercado","expenses":2}`)
+	assert.Contains(t, w.Body.String(), `"unmatched":0`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateCategorizationRule_TrimsPatternAndDefaultsCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/categorization-rules", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateCategorizationRule(c)
+	})
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`INSERT INTO categorization_rules .*COALESCE\(\$8, \(SELECT base_currency FROM users WHERE id=\$1\)\)`).
+		WithArgs(int64(1), 3, "", `^Coto\b`, nil, models.Money(10000000), int64(5), nil).
+		WillReturnRows(sqlmock.NewRows(ruleColumnNames).
+			AddRow(7, 1, 3, "", `^Coto\b`, nil, "100000.00", "ARS", 5, "Supermercado", createdAt))
+
+	body := `{"priority": 3, "namePattern": "  ^Coto\\b ", "maxAmount": 100000, "categoryId": 5}`
+	req, _ := http.NewRequest("POST", "/categorization-rules", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"currency":"ARS"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
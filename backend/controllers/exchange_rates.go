@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+// exchangeRateColumnsCSV es el encabezado esperado en la importación por CSV.
+var exchangeRateColumnsCSV = []string{"currency", "base_currency", "rate", "valid_on"}
+
+type exchangeRateInput struct {
+	Currency     string  `json:"currency" binding:"required"`
+	BaseCurrency string  `json:"baseCurrency" binding:"required"`
+	Rate         float64 `json:"rate" binding:"required,gt=0"`
+	ValidOn      string  `json:"validOn" binding:"required"`
+}
+
+// normalize valida la cotización y devuelve un mensaje para el cliente si no
+// es válida.
+func (in *exchangeRateInput) normalize() string {
+	currency, ok := parseCurrency(in.Currency)
+	if !ok {
+		return "La moneda debe ser un código ISO de tres letras, por ejemplo ARS o USD"
+	}
+	base, ok := parseCurrency(in.BaseCurrency)
+	if !ok {
+		return "La moneda base debe ser un código ISO de tres letras, por ejemplo ARS o USD"
+	}
+	if currency == base {
+		return "La moneda y la moneda base deben ser distintas"
+	}
+	if in.Rate <= 0 {
+		return "La cotización debe ser mayor a cero"
+	}
+	if _, err := time.Parse("2006-01-02", in.ValidOn); err != nil {
+		return "La fecha de vigencia debe usar el formato YYYY-MM-DD"
+	}
+	in.Currency, in.BaseCurrency = currency, base
+	return ""
+}
+
+func (h *Handler) ListExchangeRates(c *gin.Context) {
+	var where whereBuilder
+	if currencyParam := c.Query("currency"); currencyParam != "" {
+		currency, ok := parseCurrency(currencyParam)
+		if !ok {
+			respondValidationError(c, "El parámetro 'currency' debe ser un código ISO de tres letras", nil)
+			return
+		}
+		where.add("currency=?", currency)
+	}
+	if baseParam := c.Query("base"); baseParam != "" {
+		base, ok := parseCurrency(baseParam)
+		if !ok {
+			respondValidationError(c, "El parámetro 'base' debe ser un código ISO de tres letras", nil)
+			return
+		}
+		where.add("base_currency=?", base)
+	}
+
+	query := `SELECT id, currency, base_currency, rate, valid_on FROM exchange_rates`
+	if len(where.conditions) > 0 {
+		query += ` WHERE ` + where.clause()
+	}
+	query += ` ORDER BY currency, base_currency, valid_on DESC`
+
+	rows, err := h.DB.Query(query, where.args...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de cotizaciones", err)
+		return
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		var rate models.ExchangeRate
+		var validOn time.Time
+		if err := rows.Scan(&rate.ID, &rate.Currency, &rate.BaseCurrency, &rate.Rate, &validOn); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de cotizaciones", err)
+			return
+		}
+		rate.ValidOn = validOn.Format("2006-01-02")
+		rates = append(rates, rate)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exchangeRates": rates})
+}
+
+// UpsertExchangeRates guarda las cotizaciones enviadas en JSON. Si ya existe
+// una para la misma moneda, moneda base y fecha, se reemplaza.
+func (h *Handler) UpsertExchangeRates(c *gin.Context) {
+	var req struct {
+		Rates []exchangeRateInput `json:"rates" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de las cotizaciones no son válidos", err)
+		return
+	}
+	for i := range req.Rates {
+		if message := req.Rates[i].normalize(); message != "" {
+			respondValidationError(c, fmt.Sprintf("Cotización %d: %s", i+1, message), nil)
+			return
+		}
+	}
+
+	if err := h.saveExchangeRates(c, req.Rates); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron guardar las cotizaciones", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"imported": len(req.Rates)})
+}
+
+// ImportExchangeRatesCSV importa cotizaciones desde un CSV con el encabezado
+// currency,base_currency,rate,valid_on. Acepta el archivo en el campo "file"
+// de un formulario multipart o directamente como cuerpo de la petición.
+func (h *Handler) ImportExchangeRatesCSV(c *gin.Context) {
+	body, ok := csvUpload(c)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	rates, message, err := parseExchangeRatesCSV(body)
+	if message != "" {
+		respondValidationError(c, message, err)
+		return
+	}
+
+	if err := h.saveExchangeRates(c, rates); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron guardar las cotizaciones", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"imported": len(rates)})
+}
+
+// csvUpload devuelve el CSV enviado en el campo "file" de un formulario
+// multipart o, si la petición no es multipart, el cuerpo completo.
+func csvUpload(c *gin.Context) (io.ReadCloser, bool) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		return c.Request.Body, true
+	}
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		respondValidationError(c, "No se encontró el archivo CSV en el campo 'file'", err)
+		return nil, false
+	}
+	return file, true
+}
+
+// parseExchangeRatesCSV lee y valida el CSV. Si no es válido devuelve el
+// mensaje para el cliente, indicando la línea con el problema.
+func parseExchangeRatesCSV(r io.Reader) ([]exchangeRateInput, string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = len(exchangeRateColumnsCSV)
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, "El archivo CSV está vacío", nil
+		}
+		return nil, "El archivo CSV no es válido", err
+	}
+	for i, column := range exchangeRateColumnsCSV {
+		if strings.ToLower(strings.TrimSpace(header[i])) != column {
+			return nil, "El encabezado del CSV debe ser " + strings.Join(exchangeRateColumnsCSV, ","), nil
+		}
+	}
+
+	var rates []exchangeRateInput
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "El archivo CSV no es válido", err
+		}
+		line, _ := reader.FieldPos(0)
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			return nil, fmt.Sprintf("Línea %d: la cotización debe ser numérica", line), err
+		}
+		in := exchangeRateInput{
+			Currency:     record[0],
+			BaseCurrency: record[1],
+			Rate:         rate,
+			ValidOn:      strings.TrimSpace(record[3]),
+		}
+		if message := in.normalize(); message != "" {
+			return nil, fmt.Sprintf("Línea %d: %s", line, message), nil
+		}
+		rates = append(rates, in)
+	}
+	if len(rates) == 0 {
+		return nil, "El archivo CSV no tiene cotizaciones", nil
+	}
+	return rates, "", nil
+}
+
+func (h *Handler) saveExchangeRates(ctx context.Context, rates []exchangeRateInput) error {
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO exchange_rates (currency, base_currency, rate, valid_on)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (currency, base_currency, valid_on) DO UPDATE SET rate = EXCLUDED.rate`,
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, rate := range rates {
+		if _, err := stmt.ExecContext(ctx, rate.Currency, rate.BaseCurrency, rate.Rate, rate.ValidOn); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportExchangeRatesCSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.New()
+	router.POST("/exchange-rates/csv", handler.ImportExchangeRatesCSV)
+
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare("INSERT INTO exchange_rates")
+	prep.ExpectExec().WithArgs("USD", "ARS", 1050.5, "2024-03-01").WillReturnResult(sqlmock.NewResult(1, 1))
+	prep.ExpectExec().WithArgs("EUR", "ARS", 1130.0, "2024-03-01").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	body := "currency,base_currency,rate,valid_on\nusd,ARS,1050.5,2024-03-01\nEUR,ARS,1130,2024-03-01\n"
+	req, _ := http.NewRequest("POST", "/exchange-rates/csv", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"imported":2`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportExchangeRatesCSV_ReportsLine(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.New()
+	router.POST("/exchange-rates/csv", handler.ImportExchangeRatesCSV)
+
+	body := "currency,base_currency,rate,valid_on\nUSD,ARS,1050.5,2024-03-01\nUSD,ARS,mil,2024-03-02\n"
+	req, _ := http.NewRequest("POST", "/exchange-rates/csv", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Línea 3")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpsertExchangeRates_SameCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.New()
+	router.POST("/exchange-rates", handler.UpsertExchangeRates)
+
+	body := `{"rates": [{"currency": "ARS", "baseCurrency": "ars", "rate": 1, "validOn": "2024-03-01"}]}`
+	req, _ := http.NewRequest("POST", "/exchange-rates", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "deben ser distintas")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListExchangeRates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.New()
+	router.GET("/exchange-rates", handler.ListExchangeRates)
+
+	mock.ExpectQuery(`FROM exchange_rates WHERE currency=\$1`).
+		WithArgs("USD").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "currency", "base_currency", "rate", "valid_on"}).
+			AddRow(1, "USD", "ARS", 1050.5, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)))
+
+	req, _ := http.NewRequest("GET", "/exchange-rates?currency=usd", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"validOn":"2024-03-01"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireAdmin_Forbidden(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.New()
+	router.POST("/exchange-rates", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		c.Next()
+	}, handler.RequireAdmin, handler.UpsertExchangeRates)
+
+	mock.ExpectQuery(`SELECT is_admin FROM users WHERE id=\$1`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"is_admin"}).AddRow(false))
+
+	body := `{"rates": [{"currency": "USD", "baseCurrency": "ARS", "rate": 1000, "validOn": "2024-03-01"}]}`
+	req, _ := http.NewRequest("POST", "/exchange-rates", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "permisos de administrador")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,45 +1,254 @@
 package controllers
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 
 	"gestor-gastos/models"
 )
 
-func (h *Handler) ListExpenses(c *gin.Context) {
-	userID := c.GetInt64("userID")
-	fromParam := c.Query("from")
-	toParam := c.Query("to")
+const maxExpensesPageSize = 500
+
+const expenseColumns = `id, user_id, name, tag, amount, expense_date, currency, account_id, installment_plan_id, installment_number`
+
+// convertedAmountFor devuelve la expresión que convierte el monto de cada fila
+// de table a la moneda base de su usuario con la última cotización vigente en
+// date, una expresión SQL. Es NULL si no hay una cotización cargada para esa
+// fecha.
+func convertedAmountFor(table, date string) string {
+	return strings.NewReplacer("{table}", table, "{date}", date).Replace(
+		`(SELECT CASE WHEN {table}.currency = u.base_currency THEN {table}.amount
+	ELSE ROUND({table}.amount * (
+		SELECT r.rate FROM exchange_rates r
+		WHERE r.currency = {table}.currency AND r.base_currency = u.base_currency AND r.valid_on <= {date}
+		ORDER BY r.valid_on DESC LIMIT 1), 2) END
+	FROM users u WHERE u.id = {table}.user_id)`)
+}
+
+// convertedAmountSQL convierte el monto de cada fila de expenses.
+var convertedAmountSQL = convertedAmountFor("expenses", "expenses.expense_date")
+
+// scanExpense lee una fila con las columnas de expenseColumns.
+func scanExpense(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.Expense, error) {
+	var exp models.Expense
+	var date time.Time
+	var accountID, planID sql.NullInt64
+	var installmentNumber sql.NullInt32
+	dest := append([]interface{}{&exp.ID, &exp.UserID, &exp.Name, &exp.Tag, &exp.Amount, &date, &exp.Currency, &accountID,
+		&planID, &installmentNumber}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return exp, err
+	}
+	exp.Date = date.Format("2006-01-02")
+	if accountID.Valid {
+		id := accountID.Int64
+		exp.AccountID = &id
+	}
+	if planID.Valid {
+		id := planID.Int64
+		exp.InstallmentPlanID = &id
+	}
+	if installmentNumber.Valid {
+		number := int(installmentNumber.Int32)
+		exp.InstallmentNumber = &number
+	}
+	return exp, nil
+}
 
-	query := `SELECT id, user_id, name, tag, amount, expense_date FROM expenses WHERE user_id=$1`
-	args := []interface{}{userID}
+// bindCurrency valida la moneda opcional de un request. Devuelve nil si no se
+// envió, para que la consulta decida el valor por defecto: la moneda de la
+// cuenta o, si no se indica cuenta, la moneda base del usuario.
+func bindCurrency(c *gin.Context, value string) (*string, bool) {
+	if value == "" {
+		return nil, true
+	}
+	code, ok := parseCurrency(value)
+	if !ok {
+		respondValidationError(c, "La moneda debe ser un código ISO de tres letras, por ejemplo ARS o USD", nil)
+		return nil, false
+	}
+	return &code, true
+}
+
+type expenseSortColumn struct {
+	name    string
+	sqlType string
+}
+
+// expenseSortColumns mapea los valores aceptados en 'sort' a columnas seguras para el ORDER BY.
+var expenseSortColumns = map[string]expenseSortColumn{
+	"date":   {name: "expense_date", sqlType: "date"},
+	"amount": {name: "amount", sqlType: "numeric"},
+	"name":   {name: "name", sqlType: "text"},
+}
+
+// expenseCursor es la posición opaca desde la que continúa la siguiente página.
+type expenseCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func encodeExpenseCursor(sort, order string, last models.Expense) string {
+	cursor := expenseCursor{Sort: sort, Order: order, ID: last.ID}
+	switch sort {
+	case "amount":
+		cursor.Value = last.Amount.String()
+	case "name":
+		cursor.Value = last.Name
+	default:
+		cursor.Value = last.Date
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
 
-	if fromParam != "" {
+func decodeExpenseCursor(value string) (expenseCursor, error) {
+	var cursor expenseCursor
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return cursor, err
+	}
+	return cursor, nil
+}
+
+// applyExpenseFilters agrega al builder los filtros comunes de gastos recibidos
+// por query string. Si algún parámetro es inválido responde 400 y devuelve false.
+func applyExpenseFilters(c *gin.Context, where *whereBuilder) bool {
+	if fromParam := c.Query("from"); fromParam != "" {
 		if _, err := time.Parse("2006-01-02", fromParam); err != nil {
 			respondValidationError(c, "El parámetro 'from' debe usar el formato YYYY-MM-DD", err)
-			return
+			return false
 		}
-		query += fmt.Sprintf(" AND expense_date >= $%d", len(args)+1)
-		args = append(args, fromParam)
+		where.add("expense_date >= ?", fromParam)
 	}
 
-	if toParam != "" {
+	if toParam := c.Query("to"); toParam != "" {
 		if _, err := time.Parse("2006-01-02", toParam); err != nil {
 			respondValidationError(c, "El parámetro 'to' debe usar el formato YYYY-MM-DD", err)
+			return false
+		}
+		where.add("expense_date <= ?", toParam)
+	}
+
+	var tags []string
+	for _, tag := range c.QueryArray("tag") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		where.add("tag = ANY(?)", pq.Array(tags))
+	}
+
+	if accountParam := c.Query("accountId"); accountParam != "" {
+		accountID, err := strconv.ParseInt(accountParam, 10, 64)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'accountId' no es válido", err)
+			return false
+		}
+		where.add("account_id = ?", accountID)
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		where.add(`name ILIKE ?`, "%"+likeEscaper.Replace(q)+"%")
+	}
+
+	var minAmount *models.Money
+	if minParam := c.Query("minAmount"); minParam != "" {
+		parsed, err := models.ParseMoney(minParam)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'minAmount' debe ser numérico", err)
+			return false
+		}
+		minAmount = &parsed
+		where.add("amount >= ?", parsed)
+	}
+	if maxParam := c.Query("maxAmount"); maxParam != "" {
+		parsed, err := models.ParseMoney(maxParam)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'maxAmount' debe ser numérico", err)
+			return false
+		}
+		if minAmount != nil && parsed < *minAmount {
+			respondValidationError(c, "El parámetro 'maxAmount' no puede ser menor que 'minAmount'", nil)
+			return false
+		}
+		where.add("amount <= ?", parsed)
+	}
+
+	return true
+}
+
+// likeEscaper evita que los comodines del texto buscado se interpreten en ILIKE.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (h *Handler) ListExpenses(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var where whereBuilder
+	where.add("user_id=?", userID)
+	if !applyExpenseFilters(c, &where) {
+		return
+	}
+
+	sortParam := c.DefaultQuery("sort", "date")
+	sortColumn, ok := expenseSortColumns[sortParam]
+	if !ok {
+		respondValidationError(c, "El parámetro 'sort' debe ser date, amount o name", nil)
+		return
+	}
+	order := strings.ToLower(c.DefaultQuery("order", "desc"))
+	if order != "asc" && order != "desc" {
+		respondValidationError(c, "El parámetro 'order' debe ser asc o desc", nil)
+		return
+	}
+
+	limit := 0
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 || parsed > maxExpensesPageSize {
+			respondValidationError(c, fmt.Sprintf("El parámetro 'limit' debe ser un número entre 1 y %d", maxExpensesPageSize), err)
+			return
+		}
+		limit = parsed
+	}
+
+	if cursorParam := c.Query("cursor"); cursorParam != "" {
+		cursor, err := decodeExpenseCursor(cursorParam)
+		if err != nil || cursor.Sort != sortParam || cursor.Order != order {
+			respondValidationError(c, "El parámetro 'cursor' no es válido para este orden", err)
 			return
 		}
-		query += fmt.Sprintf(" AND expense_date <= $%d", len(args)+1)
-		args = append(args, toParam)
+		comparison := "<"
+		if order == "asc" {
+			comparison = ">"
+		}
+		where.add(fmt.Sprintf("(%s, id) %s (?::%s, ?::bigint)", sortColumn.name, comparison, sortColumn.sqlType),
+			cursor.Value, cursor.ID)
 	}
 
-	query += " ORDER BY expense_date DESC, id DESC"
+	query := `SELECT ` + expenseColumns + `, ` + convertedAmountSQL + ` FROM expenses WHERE ` + where.clause()
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", sortColumn.name, strings.ToUpper(order), strings.ToUpper(order))
+	if limit > 0 {
+		// Se pide una fila extra para saber si existe una página siguiente.
+		query += fmt.Sprintf(" LIMIT %d", limit+1)
+	}
 
-	rows, err := h.DB.Query(query, args...)
+	rows, err := h.DB.Query(query, where.args...)
 	if err != nil {
 		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de gastos", err)
 		return
@@ -48,26 +257,38 @@ func (h *Handler) ListExpenses(c *gin.Context) {
 
 	var expenses []models.Expense
 	for rows.Next() {
-		var exp models.Expense
-		var date time.Time
-		if err := rows.Scan(&exp.ID, &exp.UserID, &exp.Name, &exp.Tag, &exp.Amount, &date); err != nil {
+		var converted *models.Money
+		exp, err := scanExpense(rows, &converted)
+		if err != nil {
 			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de gastos", err)
 			return
 		}
-		exp.Date = date.Format("2006-01-02")
+		exp.ConvertedAmount = converted
 		expenses = append(expenses, exp)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"expenses": expenses})
+	var nextCursor *string
+	if limit > 0 && len(expenses) > limit {
+		expenses = expenses[:limit]
+		encoded := encodeExpenseCursor(sortParam, order, expenses[limit-1])
+		nextCursor = &encoded
+	}
+
+	c.JSON(http.StatusOK, gin.H{"expenses": expenses, "nextCursor": nextCursor})
 }
 
+// CreateExpense guarda un gasto. Si no se envía etiqueta se usa la de la
+// primera regla de categorización que coincida; si ninguna coincide, el gasto
+// queda sin categoría (tag vacío).
 func (h *Handler) CreateExpense(c *gin.Context) {
 	userID := c.GetInt64("userID")
 	var req struct {
-		Name   string  `json:"name" binding:"required"`
-		Tag    string  `json:"tag" binding:"required"`
-		Amount float64 `json:"amount" binding:"required"`
-		Date   string  `json:"date" binding:"required"`
+		Name      string       `json:"name" binding:"required"`
+		Tag       string       `json:"tag"`
+		Amount    models.Money `json:"amount" binding:"required,gt=0"`
+		Date      string       `json:"date" binding:"required"`
+		Currency  string       `json:"currency"`
+		AccountID *int64       `json:"accountId" binding:"omitempty,gt=0"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		respondValidationError(c, "Los datos del gasto no son válidos", err)
@@ -79,23 +300,244 @@ func (h *Handler) CreateExpense(c *gin.Context) {
 		respondValidationError(c, "La fecha del gasto no tiene el formato correcto", err)
 		return
 	}
+	currency, ok := bindCurrency(c, req.Currency)
+	if !ok {
+		return
+	}
+	if req.AccountID != nil {
+		accountCurrency, ok := h.bindAccount(c, userID, *req.AccountID)
+		if !ok {
+			return
+		}
+		if currency == nil {
+			currency = &accountCurrency
+		}
+	}
 
-	var exp models.Expense
-	err = h.DB.QueryRow(
-		`INSERT INTO expenses (user_id, name, tag, amount, expense_date)
-		 VALUES ($1, $2, $3, $4, $5)
-		 RETURNING id, user_id, name, tag, amount, expense_date`,
-		userID, req.Name, req.Tag, req.Amount, expenseDate,
-	).Scan(&exp.ID, &exp.UserID, &exp.Name, &exp.Tag, &exp.Amount, &expenseDate)
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la creación del gasto", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var rule *models.CategorizationRule
+	tag := normalizeCategoryName(req.Tag)
+	if tag != "" {
+		tag, ok = bindCategory(c, tx, userID, tag)
+		if !ok {
+			return
+		}
+	} else {
+		rule, ok = h.categorizeExpense(c, userID, req.Name, req.Amount, currency)
+		if !ok {
+			return
+		}
+		if rule != nil {
+			tag = rule.Tag
+		}
+	}
+
+	exp, err := scanExpense(tx.QueryRowContext(c,
+		`INSERT INTO expenses (user_id, name, tag, amount, expense_date, currency, account_id)
+		 VALUES ($1, $2, $3, $4, $5, COALESCE($6, (SELECT base_currency FROM users WHERE id=$1)), $7)
+		 RETURNING `+expenseColumns,
+		userID, req.Name, tag, req.Amount, expenseDate, currency, req.AccountID,
+	))
 	if err != nil {
 		respondError(c, http.StatusInternalServerError, "No se pudo guardar el gasto", err)
 		return
 	}
-	exp.Date = expenseDate.Format("2006-01-02")
 
-	c.JSON(http.StatusCreated, gin.H{
-		"expense": exp,
-	})
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la creación del gasto", err)
+		return
+	}
+
+	response := gin.H{"expense": exp}
+	if rule != nil {
+		response["ruleId"] = rule.ID
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// UpdateExpense reemplaza el gasto completo: la moneda y la cuenta que no se
+// envían toman los mismos valores por defecto que en CreateExpense, así que
+// omitir accountId deja al gasto sin cuenta.
+func (h *Handler) UpdateExpense(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	expenseID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del gasto no es válido", err)
+		return
+	}
+
+	var req struct {
+		Name      string       `json:"name" binding:"required"`
+		Tag       string       `json:"tag" binding:"required"`
+		Amount    models.Money `json:"amount" binding:"required,gt=0"`
+		Date      string       `json:"date" binding:"required"`
+		Currency  string       `json:"currency"`
+		AccountID *int64       `json:"accountId" binding:"omitempty,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos del gasto no son válidos", err)
+		return
+	}
+
+	expenseDate, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		respondValidationError(c, "La fecha del gasto no tiene el formato correcto", err)
+		return
+	}
+	currency, ok := bindCurrency(c, req.Currency)
+	if !ok {
+		return
+	}
+	if req.AccountID != nil {
+		accountCurrency, ok := h.bindAccount(c, userID, *req.AccountID)
+		if !ok {
+			return
+		}
+		if currency == nil {
+			currency = &accountCurrency
+		}
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la actualización del gasto", err)
+		return
+	}
+	defer tx.Rollback()
+
+	tag, ok := bindCategory(c, tx, userID, req.Tag)
+	if !ok {
+		return
+	}
+
+	exp, err := scanExpense(tx.QueryRowContext(c,
+		`UPDATE expenses
+		 SET name=$1, tag=$2, amount=$3, expense_date=$4, currency=COALESCE($5, (SELECT base_currency FROM users WHERE id=$8)),
+		     account_id=$6, updated_at=now()
+		 WHERE id=$7 AND user_id=$8
+		 RETURNING `+expenseColumns,
+		req.Name, tag, req.Amount, expenseDate, currency, req.AccountID, expenseID, userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el gasto solicitado", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el gasto", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la actualización del gasto", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"expense": exp})
+}
+
+func (h *Handler) PatchExpense(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	expenseID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del gasto no es válido", err)
+		return
+	}
+
+	// Los punteros permiten distinguir un campo ausente de uno enviado vacío.
+	var req struct {
+		Name      *string       `json:"name" binding:"omitempty,min=1"`
+		Tag       *string       `json:"tag" binding:"omitempty,min=1"`
+		Amount    *models.Money `json:"amount" binding:"omitempty,gt=0"`
+		Date      *string       `json:"date"`
+		Currency  *string       `json:"currency"`
+		AccountID *int64        `json:"accountId" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos del gasto no son válidos", err)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la actualización del gasto", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var set updateSet
+	if req.Name != nil {
+		set.add("name", *req.Name)
+	}
+	if req.Tag != nil {
+		tag, ok := bindCategory(c, tx, userID, *req.Tag)
+		if !ok {
+			return
+		}
+		set.add("tag", tag)
+	}
+	if req.Amount != nil {
+		set.add("amount", *req.Amount)
+	}
+	if req.Date != nil {
+		expenseDate, err := time.Parse("2006-01-02", *req.Date)
+		if err != nil {
+			respondValidationError(c, "La fecha del gasto no tiene el formato correcto", err)
+			return
+		}
+		set.add("expense_date", expenseDate)
+	}
+	if req.Currency != nil {
+		currency, ok := bindCurrency(c, *req.Currency)
+		if !ok {
+			return
+		}
+		if currency != nil {
+			set.add("currency", *currency)
+		}
+	}
+	if req.AccountID != nil {
+		if !h.bindOptionalAccount(c, userID, req.AccountID) {
+			return
+		}
+		set.add("account_id", accountArg(*req.AccountID))
+	}
+	if set.empty() {
+		respondValidationError(c, "No se enviaron campos para actualizar", nil)
+		return
+	}
+
+	query := fmt.Sprintf(
+		`UPDATE expenses
+		 SET %s, updated_at=now()
+		 WHERE id=$%d AND user_id=$%d
+		 RETURNING `+expenseColumns,
+		set.clause(), set.next(), set.next()+1,
+	)
+
+	exp, err := scanExpense(tx.QueryRowContext(c, query, set.argsWith(expenseID, userID)...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el gasto solicitado", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el gasto", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la actualización del gasto", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"expense": exp})
 }
 
 func (h *Handler) DeleteExpense(c *gin.Context) {
@@ -114,12 +556,7 @@ func (h *Handler) DeleteExpense(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec(
-		`UPDATE monthly_expenses
-		 SET last_applied_at=NULL, last_applied_expense_id=NULL
-		 WHERE user_id=$1 AND last_applied_expense_id=$2`,
-		userID, expenseID,
-	); err != nil {
+	if err := restoreLastApplication(c, tx, userID, expenseID); err != nil {
 		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el gasto recurrente asociado", err)
 		return
 	}
@@ -5,14 +5,20 @@ import (
 	"database/sql"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
 )
 
+// expenseColumnNames are the columns returned by queries selecting expenseColumns.
+var expenseColumnNames = strings.Split(expenseColumns, ", ")
+
 func TestListExpenses(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -27,10 +33,10 @@ func TestListExpenses(t *testing.T) {
 		handler.ListExpenses(c)
 	})
 
-	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, expense_date FROM expenses").
+	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, expense_date, currency, ").
 		WithArgs(int64(1)).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "tag", "amount", "expense_date"}).
-			AddRow(1, 1, "Groceries", "Food", 50.0, time.Now()))
+		WillReturnRows(sqlmock.NewRows(append(expenseColumnNames, "converted_amount")).
+			AddRow(1, 1, "Groceries", "Food", 50.0, time.Now(), "ARS", nil, nil, nil, nil))
 
 	req, _ := http.NewRequest("GET", "/expenses", nil)
 	w := httptest.NewRecorder()
@@ -57,10 +63,13 @@ func TestCreateExpense(t *testing.T) {
 	})
 
 	// Use AnyArg for the date to avoid timezone issues in test
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Food")
 	mock.ExpectQuery("INSERT INTO expenses").
-		WithArgs(int64(1), "Groceries", "Food", 50.0, sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "tag", "amount", "expense_date"}).
-			AddRow(1, 1, "Groceries", "Food", 50.0, time.Now()))
+		WithArgs(int64(1), "Groceries", "Food", models.Money(5000), sqlmock.AnyArg(), nil, nil).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(1, 1, "Groceries", "Food", 50.0, time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectCommit()
 
 	body := `{"name": "Groceries", "tag": "Food", "amount": 50.0, "date": "2023-10-27"}`
 	req, _ := http.NewRequest("POST", "/expenses", bytes.NewBufferString(body))
@@ -88,7 +97,7 @@ func TestDeleteExpense(t *testing.T) {
 	})
 
 	mock.ExpectBegin()
-	mock.ExpectExec("UPDATE monthly_expenses").
+	mock.ExpectExec(`UPDATE monthly_expenses m\s+SET \(last_applied_at, last_applied_expense_id\) = \(\s+SELECT a.applied_at, a.expense_id`).
 		WithArgs(int64(1), int64(1)).
 		WillReturnResult(sqlmock.NewResult(0, 0)) // 0 rows affected is fine
 	mock.ExpectExec("DELETE FROM expenses").
@@ -105,6 +114,37 @@ func TestDeleteExpense(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestListExpenses_IncludesConvertedAmount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.New()
+	router.GET("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ListExpenses(c)
+	})
+
+	mock.ExpectQuery(`FROM exchange_rates r WHERE r.currency = expenses.currency`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(append(expenseColumnNames, "converted_amount")).
+			AddRow(1, 1, "Hotel", "Viajes", "100.00", time.Now(), "USD", nil, nil, nil, "105050.00").
+			AddRow(2, 1, "Taxi", "Viajes", "20.00", time.Now(), "EUR", nil, nil, nil, nil))
+
+	req, _ := http.NewRequest("GET", "/expenses", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"currency":"USD","convertedAmount":105050.00`)
+	assert.NotContains(t, w.Body.String(), `"currency":"EUR","convertedAmount"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestListExpenses_WithDateFilters(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -119,10 +159,10 @@ func TestListExpenses_WithDateFilters(t *testing.T) {
 		handler.ListExpenses(c)
 	})
 
-	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, expense_date FROM expenses").
+	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, expense_date, currency, ").
 		WithArgs(int64(1), "2023-01-01", "2023-12-31").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "tag", "amount", "expense_date"}).
-			AddRow(1, 1, "Groceries", "Food", 50.0, time.Now()))
+		WillReturnRows(sqlmock.NewRows(append(expenseColumnNames, "converted_amount")).
+			AddRow(1, 1, "Groceries", "Food", 50.0, time.Now(), "ARS", nil, nil, nil, nil))
 
 	req, _ := http.NewRequest("GET", "/expenses?from=2023-01-01&to=2023-12-31", nil)
 	w := httptest.NewRecorder()
@@ -229,6 +269,32 @@ func TestCreateExpense_InvalidDateFormat(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "La fecha del gasto no tiene el formato correcto")
 }
 
+func TestCreateExpense_InvalidAmount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateExpense(c)
+	})
+
+	for _, amount := range []string{"0", "-10", "10.005", `"abc"`} {
+		body := `{"name": "Groceries", "tag": "Food", "amount": ` + amount + `, "date": "2023-10-27"}`
+		req, _ := http.NewRequest("POST", "/expenses", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, amount)
+		assert.Contains(t, w.Body.String(), "Los datos del gasto no son válidos", amount)
+	}
+}
+
 func TestDeleteExpense_NotFound(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -298,7 +364,7 @@ func TestListExpenses_DBError(t *testing.T) {
 		handler.ListExpenses(c)
 	})
 
-	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, expense_date FROM expenses").
+	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, expense_date, currency, ").
 		WithArgs(int64(1)).
 		WillReturnError(sql.ErrConnDone)
 
@@ -326,9 +392,12 @@ func TestCreateExpense_DBError(t *testing.T) {
 		handler.CreateExpense(c)
 	})
 
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Food")
 	mock.ExpectQuery("INSERT INTO expenses").
-		WithArgs(int64(1), "Groceries", "Food", 50.0, sqlmock.AnyArg()).
+		WithArgs(int64(1), "Groceries", "Food", models.Money(5000), sqlmock.AnyArg(), nil, nil).
 		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
 
 	body := `{"name": "Groceries", "tag": "Food", "amount": 50.0, "date": "2023-10-27"}`
 	req, _ := http.NewRequest("POST", "/expenses", bytes.NewBufferString(body))
@@ -340,3 +409,500 @@ func TestCreateExpense_DBError(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "No se pudo guardar el gasto")
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestUpdateExpense(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PUT("/expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateExpense(c)
+	})
+
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Food")
+	// An omitted account and currency are not kept: the expense loses its
+	// account and takes the user's base currency, as on create.
+	mock.ExpectQuery(`UPDATE expenses\s+SET .*currency=COALESCE\(\$5, \(SELECT base_currency FROM users WHERE id=\$8\)\),\s+account_id=\$6,`).
+		WithArgs("Groceries", "Food", models.Money(7550), sqlmock.AnyArg(), nil, nil, int64(3), int64(1)).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(3, 1, "Groceries", "Food", 75.5, time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectCommit()
+
+	body := `{"name": "Groceries", "tag": "Food", "amount": 75.5, "date": "2023-10-27"}`
+	req, _ := http.NewRequest("PUT", "/expenses/3", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "75.5")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateExpense_UsesAccountCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PUT("/expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateExpense(c)
+	})
+
+	mock.ExpectQuery(`SELECT currency FROM accounts WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(5), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow("USD"))
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Food")
+	mock.ExpectQuery("UPDATE expenses").
+		WithArgs("Groceries", "Food", models.Money(7550), sqlmock.AnyArg(), "USD", int64(5), int64(3), int64(1)).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(3, 1, "Groceries", "Food", 75.5, time.Now(), "USD", 5, nil, nil))
+	mock.ExpectCommit()
+
+	body := `{"name": "Groceries", "tag": "Food", "amount": 75.5, "date": "2023-10-27", "accountId": 5}`
+	req, _ := http.NewRequest("PUT", "/expenses/3", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"currency":"USD"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateExpense_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PUT("/expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateExpense(c)
+	})
+
+	// Expense owned by another user: the scoped UPDATE returns no rows
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Food")
+	mock.ExpectQuery("UPDATE expenses").
+		WithArgs("Groceries", "Food", models.Money(7550), sqlmock.AnyArg(), nil, nil, int64(99), int64(1)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	body := `{"name": "Groceries", "tag": "Food", "amount": 75.5, "date": "2023-10-27"}`
+	req, _ := http.NewRequest("PUT", "/expenses/99", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "No se encontró el gasto solicitado")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateExpense_ValidationError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PUT("/expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateExpense(c)
+	})
+
+	body := `{"name": "Groceries", "tag": "Food"}`
+	req, _ := http.NewRequest("PUT", "/expenses/3", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Los datos del gasto no son válidos")
+}
+
+func TestUpdateExpense_NegativeAmount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PUT("/expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateExpense(c)
+	})
+
+	req, _ := http.NewRequest("PUT", "/expenses/3", bytes.NewBufferString(`{"name": "Groceries", "tag": "Food", "amount": -50, "date": "2024-03-10"}`))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Los datos del gasto no son válidos")
+}
+
+func TestPatchExpense(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.PatchExpense(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE expenses\s+SET amount=\$1, updated_at=now\(\)\s+WHERE id=\$2 AND user_id=\$3`).
+		WithArgs(models.Money(8000), int64(3), int64(1)).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(3, 1, "Groceries", "Food", 80.0, time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectCommit()
+
+	body := `{"amount": 80}`
+	req, _ := http.NewRequest("PATCH", "/expenses/3", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Groceries")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPatchExpense_NoFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.PatchExpense(c)
+	})
+
+	// The update runs in a transaction, which is rolled back when there is
+	// nothing to change.
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("PATCH", "/expenses/3", bytes.NewBufferString(`{}`))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "No se enviaron campos para actualizar")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPatchExpense_EmptyName(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.PatchExpense(c)
+	})
+
+	req, _ := http.NewRequest("PATCH", "/expenses/3", bytes.NewBufferString(`{"name": ""}`))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Los datos del gasto no son válidos")
+}
+
+func TestPatchExpense_NegativeAmount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.PatchExpense(c)
+	})
+
+	req, _ := http.NewRequest("PATCH", "/expenses/3", bytes.NewBufferString(`{"amount": -80}`))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Los datos del gasto no son válidos")
+}
+
+func TestListExpenses_PaginatedReturnsNextCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ListExpenses(c)
+	})
+
+	date := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`ORDER BY amount ASC, id ASC LIMIT 2`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(append(expenseColumnNames, "converted_amount")).
+			AddRow(4, 1, "Coffee", "Food", 5.0, date, "ARS", nil, nil, nil, nil).
+			AddRow(2, 1, "Groceries", "Food", 50.0, date, "ARS", nil, nil, nil, nil))
+
+	req, _ := http.NewRequest("GET", "/expenses?limit=1&sort=amount&order=asc", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Coffee")
+	assert.NotContains(t, w.Body.String(), "Groceries")
+
+	expected := encodeExpenseCursor("amount", "asc", models.Expense{ID: 4, Amount: 500})
+	assert.Contains(t, w.Body.String(), expected)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListExpenses_WithCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ListExpenses(c)
+	})
+
+	cursor := encodeExpenseCursor("date", "desc", models.Expense{ID: 7, Date: "2024-03-10"})
+	mock.ExpectQuery(`AND \(expense_date, id\) < \(\$2::date, \$3::bigint\) ORDER BY expense_date DESC, id DESC LIMIT 11`).
+		WithArgs(int64(1), "2024-03-10", int64(7)).
+		WillReturnRows(sqlmock.NewRows(append(expenseColumnNames, "converted_amount")).
+			AddRow(6, 1, "Groceries", "Food", 50.0, time.Now(), "ARS", nil, nil, nil, nil))
+
+	req, _ := http.NewRequest("GET", "/expenses?limit=10&cursor="+cursor, nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"nextCursor":null`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListExpenses_CursorForDifferentSort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ListExpenses(c)
+	})
+
+	cursor := encodeExpenseCursor("date", "desc", models.Expense{ID: 7, Date: "2024-03-10"})
+	req, _ := http.NewRequest("GET", "/expenses?sort=name&cursor="+cursor, nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "El parámetro 'cursor' no es válido para este orden")
+}
+
+func TestListExpenses_InvalidSortAndLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ListExpenses(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/expenses?sort=tag", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "El parámetro 'sort' debe ser date, amount o name")
+
+	req, _ = http.NewRequest("GET", "/expenses?limit=0", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "El parámetro 'limit'")
+}
+
+func TestListExpenses_RichFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ListExpenses(c)
+	})
+
+	mock.ExpectQuery(`WHERE user_id=\$1 AND expense_date >= \$2 AND expense_date <= \$3 AND tag = ANY\(\$4\) AND name ILIKE \$5 AND amount >= \$6`).
+		WithArgs(int64(1), "2024-03-01", "2024-03-31", sqlmock.AnyArg(), `%super\_%`, models.Money(2000000)).
+		WillReturnRows(sqlmock.NewRows(append(expenseColumnNames, "converted_amount")).
+			AddRow(1, 1, "Super_Dia", "Supermercado", 25000.0, time.Now(), "ARS", nil, nil, nil, nil))
+
+	req, _ := http.NewRequest("GET", "/expenses?from=2024-03-01&to=2024-03-31&tag=Supermercado&tag=Almacén&q=super_&minAmount=20000", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Super_Dia")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListExpenses_InvalidAmountRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ListExpenses(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/expenses?minAmount=100&maxAmount=50", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "no puede ser menor que 'minAmount'")
+
+	req, _ = http.NewRequest("GET", "/expenses?maxAmount=abc", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "El parámetro 'maxAmount' debe ser numérico")
+}
+
+func TestCreateExpense_UsesAccountCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateExpense(c)
+	})
+
+	mock.ExpectQuery(`SELECT currency FROM accounts WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(4), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"currency"}).AddRow("USD"))
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Viajes")
+	mock.ExpectQuery("INSERT INTO expenses").
+		WithArgs(int64(1), "Hotel", "Viajes", models.Money(12000), sqlmock.AnyArg(), "USD", int64(4)).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(1, 1, "Hotel", "Viajes", "120.00", time.Now(), "USD", 4, nil, nil))
+	mock.ExpectCommit()
+
+	body := `{"name": "Hotel", "tag": "Viajes", "amount": 120, "date": "2024-03-10", "accountId": 4}`
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"accountId":4`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateExpense_UnknownAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateExpense(c)
+	})
+
+	mock.ExpectQuery(`SELECT currency FROM accounts`).
+		WithArgs(int64(9), int64(1)).
+		WillReturnError(sql.ErrNoRows)
+
+	body := `{"name": "Hotel", "tag": "Viajes", "amount": 120, "date": "2024-03-10", "accountId": 9}`
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "La cuenta indicada no existe")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+const (
+	defaultForecastMonths = 3
+	maxForecastMonths     = 24
+	// forecastHistoryMonths es la cantidad de meses completos usados para el
+	// promedio histórico por etiqueta.
+	forecastHistoryMonths = 6
+)
+
+// Forecast proyecta los egresos de los próximos meses, empezando por el mes
+// siguiente. Suma las plantillas recurrentes activas, los gastos ya cargados
+// con fecha futura (como las cuotas) y el promedio histórico por etiqueta de
+// los gastos que no provienen de ninguno de los dos. Los montos se convierten
+// a la moneda base del usuario; las plantillas con la cotización de hoy. Lo
+// que no tiene cotización se cuenta en "unconverted" y no suma.
+func (h *Handler) Forecast(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	months := defaultForecastMonths
+	if monthsParam := c.Query("months"); monthsParam != "" {
+		parsed, err := strconv.Atoi(monthsParam)
+		if err != nil || parsed < 1 || parsed > maxForecastMonths {
+			respondValidationError(c, "El parámetro 'months' debe ser un número entre 1 y 24", err)
+			return
+		}
+		months = parsed
+	}
+
+	now := time.Now()
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	start := currentMonth.AddDate(0, 1, 0)
+	end := start.AddDate(0, months, 0)
+
+	forecast := make([]models.ForecastMonth, months)
+	tagsByMonth := make([]map[string]*models.ForecastTag, months)
+	for i := range forecast {
+		forecast[i].Month = start.AddDate(0, i, 0).Format("2006-01")
+		tagsByMonth[i] = map[string]*models.ForecastTag{}
+	}
+	entry := func(month time.Time, tag string) *models.ForecastTag {
+		i := (month.Year()-start.Year())*12 + int(month.Month()-start.Month())
+		t, ok := tagsByMonth[i][tag]
+		if !ok {
+			t = &models.ForecastTag{Tag: tag}
+			tagsByMonth[i][tag] = t
+		}
+		return t
+	}
+
+	var unconverted int64
+	rows, err := h.DB.Query(
+		`SELECT `+monthlyExpenseColumns+`, `+convertedAmountFor("monthly_expenses", "CURRENT_DATE")+`
+		 FROM monthly_expenses
+		 WHERE user_id=$1 AND NOT paused`, userID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron obtener los gastos recurrentes", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var amount *models.Money
+		item, err := scanMonthlyExpense(rows, &amount)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudieron leer los gastos recurrentes", err)
+			return
+		}
+		if amount == nil {
+			unconverted++
+			continue
+		}
+		// Se cuenta desde el mes actual para que las ocurrencias pendientes
+		// de este mes consuman el máximo de aplicaciones de la plantilla.
+		for _, due := range item.OccurrencesBetween(currentMonth, end) {
+			if due.Before(start) {
+				continue
+			}
+			entry(due, item.Tag).Recurring += *amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron leer los gastos recurrentes", err)
+		return
+	}
+
+	scheduled, err := h.DB.Query(
+		`SELECT date_trunc('month', expense_date)::date AS month, tag,
+		        COALESCE(SUM(`+convertedAmountSQL+`), 0), COUNT(*) - COUNT(`+convertedAmountSQL+`)
+		 FROM expenses
+		 WHERE user_id=$1 AND expense_date >= $2 AND expense_date < $3
+		 GROUP BY month, tag`,
+		userID, start, end,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron obtener los gastos programados", err)
+		return
+	}
+	defer scheduled.Close()
+	for scheduled.Next() {
+		var month time.Time
+		var tag string
+		var total models.Money
+		var missing int64
+		if err := scheduled.Scan(&month, &tag, &total, &missing); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudieron leer los gastos programados", err)
+			return
+		}
+		entry(month, tag).Scheduled += total
+		unconverted += missing
+	}
+	if err := scheduled.Err(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron leer los gastos programados", err)
+		return
+	}
+
+	// El promedio excluye los gastos generados por plantillas y cuotas, que ya
+	// se proyectan por separado.
+	averages, err := h.DB.Query(
+		`SELECT tag, ROUND(COALESCE(SUM(`+convertedAmountFor("e", "e.expense_date")+`), 0) / $4, 2),
+		        COUNT(*) - COUNT(`+convertedAmountFor("e", "e.expense_date")+`)
+		 FROM expenses e
+		 WHERE e.user_id=$1 AND e.expense_date >= $2 AND e.expense_date < $3
+		   AND e.installment_plan_id IS NULL
+		   AND NOT EXISTS (SELECT 1 FROM monthly_expense_applications a WHERE a.expense_id = e.id)
+		 GROUP BY tag`,
+		userID, currentMonth.AddDate(0, -forecastHistoryMonths, 0), currentMonth, forecastHistoryMonths,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo calcular el promedio histórico", err)
+		return
+	}
+	defer averages.Close()
+	for averages.Next() {
+		var tag string
+		var average models.Money
+		var missing int64
+		if err := averages.Scan(&tag, &average, &missing); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer el promedio histórico", err)
+			return
+		}
+		unconverted += missing
+		for i := range forecast {
+			entry(start.AddDate(0, i, 0), tag).Estimated += average
+		}
+	}
+	if err := averages.Err(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo leer el promedio histórico", err)
+		return
+	}
+
+	for i := range forecast {
+		month := &forecast[i]
+		month.Tags = []models.ForecastTag{}
+		for _, t := range tagsByMonth[i] {
+			t.Total = t.Recurring + t.Scheduled + t.Estimated
+			month.Recurring += t.Recurring
+			month.Scheduled += t.Scheduled
+			month.Estimated += t.Estimated
+			month.Tags = append(month.Tags, *t)
+		}
+		sort.Slice(month.Tags, func(a, b int) bool { return month.Tags[a].Tag < month.Tags[b].Tag })
+		month.Total = month.Recurring + month.Scheduled + month.Estimated
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"forecast":      forecast,
+		"historyMonths": forecastHistoryMonths,
+		"unconverted":   unconverted,
+	})
+}
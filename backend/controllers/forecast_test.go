@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
+)
+
+func TestForecast(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/forecast", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.Forecast(c)
+	})
+
+	now := time.Now()
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+
+	// A USD template is converted at today's rate; the second one has no rate.
+	createdAt := time.Date(2023, 1, 15, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT "+monthlyExpenseColumns+", (SELECT CASE WHEN monthly_expenses.currency") +
+		`.*r.valid_on <= CURRENT_DATE.*\s+FROM monthly_expenses\s+WHERE user_id=\$1 AND NOT paused`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(append(strings.Split(monthlyExpenseColumns, ", "), "converted")).
+			AddRow(1, 1, "Rent", "Housing", 1.0, nil, nil, false, "monthly", nil, createdAt, nil, nil, false, nil, "USD", nil, 0, 1000.0).
+			AddRow(2, 1, "Netflix", "Ocio", 10.0, nil, nil, false, "monthly", nil, createdAt, nil, nil, false, nil, "EUR", nil, 0, nil))
+	mock.ExpectQuery("SELECT date_trunc\\('month', expense_date\\)::date AS month, tag").
+		WithArgs(int64(1), nextMonth, nextMonth.AddDate(0, 2, 0)).
+		WillReturnRows(sqlmock.NewRows([]string{"month", "tag", "sum", "unconverted"}).
+			AddRow(nextMonth, "Hogar", 33.34, 1))
+	mock.ExpectQuery("NOT EXISTS \\(SELECT 1 FROM monthly_expense_applications").
+		WithArgs(int64(1), sqlmock.AnyArg(), sqlmock.AnyArg(), forecastHistoryMonths).
+		WillReturnRows(sqlmock.NewRows([]string{"tag", "average", "unconverted"}).
+			AddRow("Food", 150.5, 0))
+
+	req, _ := http.NewRequest("GET", "/forecast?months=2", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Forecast    []models.ForecastMonth `json:"forecast"`
+		Unconverted int64                  `json:"unconverted"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body.Forecast, 2)
+	assert.Equal(t, nextMonth.Format("2006-01"), body.Forecast[0].Month)
+	assert.Equal(t, models.Money(100000), body.Forecast[0].Recurring)
+	assert.Equal(t, models.Money(3334), body.Forecast[0].Scheduled)
+	assert.Equal(t, models.Money(15050), body.Forecast[0].Estimated)
+	assert.Equal(t, models.Money(118384), body.Forecast[0].Total)
+	assert.Equal(t, models.Money(115050), body.Forecast[1].Total)
+	assert.Len(t, body.Forecast[0].Tags, 3)
+	assert.Equal(t, int64(2), body.Unconverted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForecast_InvalidMonths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/forecast", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.Forecast(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/forecast?months=0", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "El parámetro 'months' debe ser un número entre 1 y 24")
+}
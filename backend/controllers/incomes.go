@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"gestor-gastos/models"
+)
+
+const incomeColumns = `id, user_id, source, tag, amount, income_date, currency, account_id, monthly_income_id`
+
+// scanIncome lee una fila con las columnas de incomeColumns.
+func scanIncome(row interface{ Scan(...interface{}) error }) (models.Income, error) {
+	var income models.Income
+	var date time.Time
+	var accountID, monthlyIncomeID sql.NullInt64
+	if err := row.Scan(&income.ID, &income.UserID, &income.Source, &income.Tag, &income.Amount, &date,
+		&income.Currency, &accountID, &monthlyIncomeID); err != nil {
+		return income, err
+	}
+	income.Date = date.Format("2006-01-02")
+	if accountID.Valid {
+		id := accountID.Int64
+		income.AccountID = &id
+	}
+	if monthlyIncomeID.Valid {
+		id := monthlyIncomeID.Int64
+		income.MonthlyIncomeID = &id
+	}
+	return income, nil
+}
+
+func (h *Handler) ListIncomes(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var where whereBuilder
+	where.add("user_id=?", userID)
+	if fromParam := c.Query("from"); fromParam != "" {
+		if _, err := time.Parse("2006-01-02", fromParam); err != nil {
+			respondValidationError(c, "El parámetro 'from' debe usar el formato YYYY-MM-DD", err)
+			return
+		}
+		where.add("income_date >= ?", fromParam)
+	}
+	if toParam := c.Query("to"); toParam != "" {
+		if _, err := time.Parse("2006-01-02", toParam); err != nil {
+			respondValidationError(c, "El parámetro 'to' debe usar el formato YYYY-MM-DD", err)
+			return
+		}
+		where.add("income_date <= ?", toParam)
+	}
+	var tags []string
+	for _, tag := range c.QueryArray("tag") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		where.add("tag = ANY(?)", pq.Array(tags))
+	}
+	if accountParam := c.Query("accountId"); accountParam != "" {
+		accountID, err := strconv.ParseInt(accountParam, 10, 64)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'accountId' no es válido", err)
+			return
+		}
+		where.add("account_id = ?", accountID)
+	}
+
+	rows, err := h.DB.Query(
+		`SELECT `+incomeColumns+` FROM incomes WHERE `+where.clause()+` ORDER BY income_date DESC, id DESC`,
+		where.args...,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de ingresos", err)
+		return
+	}
+	defer rows.Close()
+
+	incomes := []models.Income{}
+	for rows.Next() {
+		income, err := scanIncome(rows)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de ingresos", err)
+			return
+		}
+		incomes = append(incomes, income)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"incomes": incomes})
+}
+
+func (h *Handler) CreateIncome(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	var req struct {
+		Source    string       `json:"source" binding:"required"`
+		Tag       string       `json:"tag" binding:"required"`
+		Amount    models.Money `json:"amount" binding:"required,gt=0"`
+		Date      string       `json:"date" binding:"required"`
+		Currency  string       `json:"currency"`
+		AccountID *int64       `json:"accountId" binding:"omitempty,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos del ingreso no son válidos", err)
+		return
+	}
+
+	incomeDate, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		respondValidationError(c, "La fecha del ingreso no tiene el formato correcto", err)
+		return
+	}
+	currency, ok := bindCurrency(c, req.Currency)
+	if !ok {
+		return
+	}
+	if req.AccountID != nil {
+		accountCurrency, ok := h.bindAccount(c, userID, *req.AccountID)
+		if !ok {
+			return
+		}
+		if currency == nil {
+			currency = &accountCurrency
+		}
+	}
+
+	income, err := scanIncome(h.DB.QueryRow(
+		`INSERT INTO incomes (user_id, source, tag, amount, income_date, currency, account_id)
+		 VALUES ($1, $2, $3, $4, $5, COALESCE($6, (SELECT base_currency FROM users WHERE id=$1)), $7)
+		 RETURNING `+incomeColumns,
+		userID, req.Source, req.Tag, req.Amount, incomeDate, currency, req.AccountID,
+	))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo guardar el ingreso", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"income": income})
+}
+
+func (h *Handler) PatchIncome(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	incomeID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del ingreso no es válido", err)
+		return
+	}
+
+	var req struct {
+		Source    *string       `json:"source" binding:"omitempty,min=1"`
+		Tag       *string       `json:"tag" binding:"omitempty,min=1"`
+		Amount    *models.Money `json:"amount" binding:"omitempty,gt=0"`
+		Date      *string       `json:"date"`
+		Currency  *string       `json:"currency"`
+		AccountID *int64        `json:"accountId" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos del ingreso no son válidos", err)
+		return
+	}
+
+	var set updateSet
+	if req.Source != nil {
+		set.add("source", *req.Source)
+	}
+	if req.Tag != nil {
+		set.add("tag", *req.Tag)
+	}
+	if req.Amount != nil {
+		set.add("amount", *req.Amount)
+	}
+	if req.Date != nil {
+		incomeDate, err := time.Parse("2006-01-02", *req.Date)
+		if err != nil {
+			respondValidationError(c, "La fecha del ingreso no tiene el formato correcto", err)
+			return
+		}
+		set.add("income_date", incomeDate)
+	}
+	if req.Currency != nil {
+		currency, ok := bindCurrency(c, *req.Currency)
+		if !ok {
+			return
+		}
+		if currency != nil {
+			set.add("currency", *currency)
+		}
+	}
+	if req.AccountID != nil {
+		if !h.bindOptionalAccount(c, userID, req.AccountID) {
+			return
+		}
+		set.add("account_id", accountArg(*req.AccountID))
+	}
+	if set.empty() {
+		respondValidationError(c, "No se enviaron campos para actualizar", nil)
+		return
+	}
+
+	income, err := scanIncome(h.DB.QueryRow(
+		fmt.Sprintf(
+			`UPDATE incomes
+			 SET %s, updated_at=now()
+			 WHERE id=$%d AND user_id=$%d
+			 RETURNING `+incomeColumns,
+			set.clause(), set.next(), set.next()+1,
+		),
+		set.argsWith(incomeID, userID)...,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el ingreso solicitado", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el ingreso", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"income": income})
+}
+
+// DeleteIncome borra el ingreso. Si lo había generado una plantilla, la
+// plantilla vuelve a quedar aplicada con su ingreso anterior, o sin aplicar.
+func (h *Handler) DeleteIncome(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	incomeID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del ingreso no es válido", err)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la operación de eliminación", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := restoreLastIncomeApplication(c, tx, userID, incomeID); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el ingreso recurrente asociado", err)
+		return
+	}
+
+	result, err := tx.Exec(`DELETE FROM incomes WHERE id=$1 AND user_id=$2`, incomeID, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo eliminar el ingreso", err)
+		return
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la eliminación del ingreso", err)
+		return
+	}
+	if rows == 0 {
+		respondError(c, http.StatusNotFound, "No se encontró el ingreso solicitado", nil)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la eliminación del ingreso", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
+)
+
+// incomeColumnNames are the columns returned by queries selecting incomeColumns.
+var incomeColumnNames = strings.Split(incomeColumns, ", ")
+
+func TestCreateIncome(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/incomes", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateIncome(c)
+	})
+
+	mock.ExpectQuery("INSERT INTO incomes").
+		WithArgs(int64(1), "Empresa", "Sueldo", models.Money(150000000), sqlmock.AnyArg(), "USD", nil).
+		WillReturnRows(sqlmock.NewRows(incomeColumnNames).
+			AddRow(1, 1, "Empresa", "Sueldo", "1500000.00", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), "USD", nil, nil))
+
+	body := `{"source": "Empresa", "tag": "Sueldo", "amount": 1500000, "date": "2024-03-05", "currency": "usd"}`
+	req, _ := http.NewRequest("POST", "/incomes", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"source":"Empresa"`)
+	assert.Contains(t, w.Body.String(), `"date":"2024-03-05"`)
+	assert.NotContains(t, w.Body.String(), "monthlyIncomeId")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListIncomes_WithFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/incomes", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ListIncomes(c)
+	})
+
+	mock.ExpectQuery(`FROM incomes WHERE user_id=\$1 AND income_date >= \$2 AND tag = ANY\(\$3\) ORDER BY income_date DESC`).
+		WithArgs(int64(1), "2024-01-01", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(incomeColumnNames).
+			AddRow(2, 1, "Empresa", "Sueldo", "1500000.00", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), "ARS", nil, 4))
+
+	req, _ := http.NewRequest("GET", "/incomes?from=2024-01-01&tag=Sueldo", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"monthlyIncomeId":4`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteIncome_RestoresTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.DELETE("/incomes/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.DeleteIncome(c)
+	})
+
+	mock.ExpectBegin()
+	// The template goes back to the previous application before the income is
+	// removed, since last_applied_income_id references it.
+	mock.ExpectExec(`UPDATE monthly_incomes m\s+SET \(last_applied_at, last_applied_income_id\) = \(\s+SELECT a.applied_at, a.income_id\s+FROM monthly_income_applications a`).
+		WithArgs(int64(1), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM incomes WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(7), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest("DELETE", "/incomes/7", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteIncome_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.DELETE("/incomes/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.DeleteIncome(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE monthly_incomes").
+		WithArgs(int64(1), int64(99)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM incomes`).
+		WithArgs(int64(99), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("DELETE", "/incomes/99", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "No se encontró el ingreso solicitado")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+const installmentPlanColumns = `id, user_id, name, tag, total, installments, first_due_date, interest_rate, account_id, cancelled_at, created_at`
+
+func scanInstallmentPlan(row interface{ Scan(...interface{}) error }) (models.InstallmentPlan, error) {
+	var p models.InstallmentPlan
+	var firstDue time.Time
+	var cancelledAt sql.NullTime
+	var accountID sql.NullInt64
+	if err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.Tag, &p.Total, &p.Installments, &firstDue,
+		&p.InterestRate, &accountID, &cancelledAt, &p.CreatedAt); err != nil {
+		return p, err
+	}
+	p.FirstDueDate = firstDue.Format("2006-01-02")
+	if accountID.Valid {
+		id := accountID.Int64
+		p.AccountID = &id
+	}
+	if cancelledAt.Valid {
+		p.CancelledAt = &cancelledAt.Time
+	}
+	return p, nil
+}
+
+func (h *Handler) ListInstallmentPlans(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	rows, err := h.DB.Query(
+		`SELECT `+installmentPlanColumns+`
+		 FROM installment_plans
+		 WHERE user_id=$1
+		 ORDER BY first_due_date DESC, id DESC`, userID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de compras en cuotas", err)
+		return
+	}
+	defer rows.Close()
+
+	plans := []models.InstallmentPlan{}
+	for rows.Next() {
+		p, err := scanInstallmentPlan(rows)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de compras en cuotas", err)
+			return
+		}
+		plans = append(plans, p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"installmentPlans": plans})
+}
+
+// CreateInstallmentPlan guarda la compra y genera, en la misma transacción, un
+// gasto por cuota con la leyenda "cuota N/M" en el nombre.
+func (h *Handler) CreateInstallmentPlan(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	var req struct {
+		Name         string       `json:"name" binding:"required"`
+		Tag          string       `json:"tag" binding:"required"`
+		Total        models.Money `json:"total" binding:"required,gt=0"`
+		Installments int          `json:"installments" binding:"required,min=1,max=120"`
+		FirstDueDate string       `json:"firstDueDate" binding:"required"`
+		// InterestRate es el porcentaje total de recargo sobre el precio; el
+		// máximo es el que admite la columna NUMERIC(7,4).
+		InterestRate float64 `json:"interestRate" binding:"omitempty,min=0,max=999.9999"`
+		// AccountID es la cuenta (normalmente una tarjeta) a la que se cargan las cuotas.
+		AccountID *int64 `json:"accountId" binding:"omitempty,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de la compra en cuotas no son válidos", err)
+		return
+	}
+	firstDue, err := time.Parse("2006-01-02", req.FirstDueDate)
+	if err != nil {
+		respondValidationError(c, "La fecha de la primera cuota debe usar el formato YYYY-MM-DD", err)
+		return
+	}
+	var currency *string
+	if req.AccountID != nil {
+		accountCurrency, ok := h.bindAccount(c, userID, *req.AccountID)
+		if !ok {
+			return
+		}
+		currency = &accountCurrency
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la creación de la compra en cuotas", err)
+		return
+	}
+	defer tx.Rollback()
+
+	tag, ok := bindCategory(c, tx, userID, req.Tag)
+	if !ok {
+		return
+	}
+
+	plan, err := scanInstallmentPlan(tx.QueryRowContext(c,
+		`INSERT INTO installment_plans (user_id, name, tag, total, installments, first_due_date, interest_rate, account_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 RETURNING `+installmentPlanColumns,
+		userID, req.Name, tag, req.Total, req.Installments, req.FirstDueDate, req.InterestRate, req.AccountID,
+	))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo guardar la compra en cuotas", err)
+		return
+	}
+
+	expenses := []models.Expense{}
+	for _, inst := range plan.Schedule(firstDue) {
+		// Las cuotas se registran en la moneda de la cuenta o, si no se indicó
+		// ninguna, en la moneda base del usuario.
+		exp, err := scanExpense(tx.QueryRowContext(c,
+			`INSERT INTO expenses (user_id, name, tag, amount, expense_date, installment_plan_id, installment_number, account_id, currency)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, (SELECT base_currency FROM users WHERE id=$1)))
+			 RETURNING `+expenseColumns,
+			userID, fmt.Sprintf("%s (%s)", plan.Name, models.InstallmentLabel(inst.Number, plan.Installments)),
+			plan.Tag, inst.Amount, inst.Date.Format("2006-01-02"), plan.ID, inst.Number, plan.AccountID, currency,
+		))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudieron generar las cuotas", err)
+			return
+		}
+		expenses = append(expenses, exp)
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la compra en cuotas", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"installmentPlan": plan,
+		"expenses":        expenses,
+	})
+}
+
+// CancelInstallmentPlan borra las cuotas que todavía no vencieron y marca el
+// plan como cancelado. Las cuotas ya vencidas se conservan.
+func (h *Handler) CancelInstallmentPlan(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	planID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador de la compra en cuotas no es válido", err)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la cancelación de la compra en cuotas", err)
+		return
+	}
+	defer tx.Rollback()
+
+	plan, err := scanInstallmentPlan(tx.QueryRowContext(c,
+		`SELECT `+installmentPlanColumns+`
+		 FROM installment_plans
+		 WHERE id=$1 AND user_id=$2
+		 FOR UPDATE`,
+		planID, userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró la compra en cuotas solicitada", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo recuperar la compra en cuotas", err)
+		return
+	}
+	if plan.CancelledAt != nil {
+		respondError(c, http.StatusBadRequest, "La compra en cuotas ya fue cancelada", nil)
+		return
+	}
+
+	result, err := tx.ExecContext(c,
+		`DELETE FROM expenses
+		 WHERE installment_plan_id=$1 AND user_id=$2 AND expense_date > CURRENT_DATE`,
+		planID, userID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron eliminar las cuotas pendientes", err)
+		return
+	}
+	cancelled, _ := result.RowsAffected()
+
+	plan, err = scanInstallmentPlan(tx.QueryRowContext(c,
+		`UPDATE installment_plans
+		 SET cancelled_at=now()
+		 WHERE id=$1 AND user_id=$2
+		 RETURNING `+installmentPlanColumns,
+		planID, userID,
+	))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo cancelar la compra en cuotas", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la cancelación de la compra en cuotas", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"installmentPlan":       plan,
+		"cancelledInstallments": cancelled,
+	})
+}
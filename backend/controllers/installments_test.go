@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
+)
+
+func installmentPlanRow(cancelledAt interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows(strings.Split(installmentPlanColumns, ", ")).
+		AddRow(1, 1, "TV", "Hogar", 100.0, 3, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), 0.0, nil, cancelledAt,
+			time.Date(2024, 1, 20, 10, 0, 0, 0, time.UTC))
+}
+
+func TestCreateInstallmentPlan(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/installment-plans", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateInstallmentPlan(c)
+	})
+
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Hogar")
+	mock.ExpectQuery("INSERT INTO installment_plans").
+		WithArgs(int64(1), "TV", "Hogar", models.Money(10000), 3, "2024-01-31", 0.0, nil).
+		WillReturnRows(installmentPlanRow(nil))
+	installments := []struct {
+		name   string
+		amount models.Money
+		date   time.Time
+	}{
+		{"TV (cuota 1/3)", 3334, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"TV (cuota 2/3)", 3333, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"TV (cuota 3/3)", 3333, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	for i, inst := range installments {
+		mock.ExpectQuery("INSERT INTO expenses").
+			WithArgs(int64(1), inst.name, "Hogar", inst.amount, inst.date.Format("2006-01-02"), int64(1), i+1, nil, nil).
+			WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+				AddRow(10+i, 1, inst.name, "Hogar", inst.amount.String(), inst.date, "ARS", nil, int64(1), i+1))
+	}
+	mock.ExpectCommit()
+
+	body := `{"name": "TV", "tag": "Hogar", "total": 100, "installments": 3, "firstDueDate": "2024-01-31"}`
+	req, _ := http.NewRequest("POST", "/installment-plans", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), "TV (cuota 3/3)")
+	assert.Contains(t, w.Body.String(), `"installmentPlanId":1,"installmentNumber":3`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateInstallmentPlan_ValidationError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/installment-plans", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateInstallmentPlan(c)
+	})
+
+	body := `{"name": "TV", "tag": "Hogar", "total": 100, "installments": 0, "firstDueDate": "2024-01-31"}`
+	req, _ := http.NewRequest("POST", "/installment-plans", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Los datos de la compra en cuotas no son válidos")
+}
+
+func TestCreateInstallmentPlan_InvalidAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/installment-plans", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateInstallmentPlan(c)
+	})
+
+	body := `{"name": "TV", "tag": "Hogar", "total": 100, "installments": 3, "firstDueDate": "2024-01-31", "accountId": 0}`
+	req, _ := http.NewRequest("POST", "/installment-plans", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Los datos de la compra en cuotas no son válidos")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateInstallmentPlan_InterestRateTooHigh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/installment-plans", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateInstallmentPlan(c)
+	})
+
+	body := `{"name": "TV", "tag": "Hogar", "total": 100, "installments": 3, "firstDueDate": "2024-01-31", "interestRate": 1000}`
+	req, _ := http.NewRequest("POST", "/installment-plans", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Los datos de la compra en cuotas no son válidos")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCancelInstallmentPlan(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/installment-plans/:id/cancel", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CancelInstallmentPlan(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM installment_plans").
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(installmentPlanRow(nil))
+	mock.ExpectExec("DELETE FROM expenses\\s+WHERE installment_plan_id=\\$1 AND user_id=\\$2 AND expense_date > CURRENT_DATE").
+		WithArgs(int64(1), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("UPDATE installment_plans\\s+SET cancelled_at=now\\(\\)").
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(installmentPlanRow(time.Now()))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest("POST", "/installment-plans/1/cancel", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"cancelledInstallments":2`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCancelInstallmentPlan_AlreadyCancelled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/installment-plans/:id/cancel", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CancelInstallmentPlan(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM installment_plans").
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(installmentPlanRow(time.Now()))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("POST", "/installment-plans/1/cancel", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "La compra en cuotas ya fue cancelada")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
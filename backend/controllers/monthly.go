@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,10 +13,61 @@ import (
 	"gestor-gastos/models"
 )
 
+const monthlyExpenseColumns = `id, user_id, name, tag, amount, last_applied_at, last_applied_expense_id, auto_apply, frequency, day_of_month, created_at, ` +
+	`starts_on, ends_on, paused, max_occurrences, currency, account_id, ` +
+	`(SELECT COUNT(*) FROM monthly_expense_applications a WHERE a.monthly_expense_id = monthly_expenses.id) AS occurrences`
+
+// scanMonthlyExpense lee una fila con las columnas de monthlyExpenseColumns,
+// seguidas de las columnas que reciben extra.
+func scanMonthlyExpense(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.MonthlyExpense, error) {
+	var item models.MonthlyExpense
+	var lastApplied sql.NullTime
+	var lastExpense sql.NullInt64
+	var dayOfMonth sql.NullInt32
+	var startsOn, endsOn sql.NullTime
+	var maxOccurrences sql.NullInt32
+	var accountID sql.NullInt64
+	dest := append([]interface{}{&item.ID, &item.UserID, &item.Name, &item.Tag, &item.Amount, &lastApplied, &lastExpense,
+		&item.AutoApply, &item.Frequency, &dayOfMonth, &item.CreatedAt,
+		&startsOn, &endsOn, &item.Paused, &maxOccurrences, &item.Currency, &accountID, &item.Occurrences}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return item, err
+	}
+	if accountID.Valid {
+		id := accountID.Int64
+		item.AccountID = &id
+	}
+	if startsOn.Valid {
+		item.StartsOn = &startsOn.Time
+	}
+	if endsOn.Valid {
+		item.EndsOn = &endsOn.Time
+	}
+	if maxOccurrences.Valid {
+		limit := int(maxOccurrences.Int32)
+		item.MaxOccurrences = &limit
+	}
+	if dayOfMonth.Valid {
+		day := int(dayOfMonth.Int32)
+		item.DayOfMonth = &day
+	}
+	if lastApplied.Valid {
+		item.LastAppliedAt = &lastApplied.Time
+	}
+	if lastExpense.Valid {
+		id := lastExpense.Int64
+		item.LastExpenseID = &id
+	}
+	item.Due = item.IsDue(time.Now())
+	return item, nil
+}
+
 func (h *Handler) ListMonthlyExpenses(c *gin.Context) {
 	userID := c.GetInt64("userID")
+	// due=true deja solo las plantillas pendientes en el período actual.
+	onlyDue := c.Query("due") == "true"
 	rows, err := h.DB.Query(
-		`SELECT id, user_id, name, tag, amount, last_applied_at, last_applied_expense_id
+		`SELECT `+monthlyExpenseColumns+`
 		 FROM monthly_expenses
 		 WHERE user_id=$1
 		 ORDER BY id DESC`, userID,
@@ -27,19 +80,13 @@ func (h *Handler) ListMonthlyExpenses(c *gin.Context) {
 
 	var monthly []models.MonthlyExpense
 	for rows.Next() {
-		var item models.MonthlyExpense
-		var lastApplied sql.NullTime
-		var lastExpense sql.NullInt64
-		if err := rows.Scan(&item.ID, &item.UserID, &item.Name, &item.Tag, &item.Amount, &lastApplied, &lastExpense); err != nil {
+		item, err := scanMonthlyExpense(rows)
+		if err != nil {
 			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de gastos mensuales", err)
 			return
 		}
-		if lastApplied.Valid {
-			item.LastAppliedAt = &lastApplied.Time
-		}
-		if lastExpense.Valid {
-			id := lastExpense.Int64
-			item.LastExpenseID = &id
+		if onlyDue && !item.Due {
+			continue
 		}
 		monthly = append(monthly, item)
 	}
@@ -50,30 +97,195 @@ func (h *Handler) ListMonthlyExpenses(c *gin.Context) {
 func (h *Handler) CreateMonthlyExpense(c *gin.Context) {
 	userID := c.GetInt64("userID")
 	var req struct {
-		Name   string  `json:"name" binding:"required"`
-		Tag    string  `json:"tag" binding:"required"`
-		Amount float64 `json:"amount" binding:"required"`
+		Name   string       `json:"name" binding:"required"`
+		Tag    string       `json:"tag" binding:"required"`
+		Amount models.Money `json:"amount" binding:"required,gt=0"`
+		scheduleInput
+		Currency  string `json:"currency"`
+		AccountID *int64 `json:"accountId" binding:"omitempty,gt=0"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		respondValidationError(c, "Los datos del gasto recurrente no son válidos", err)
 		return
 	}
+	startsOn, endsOn, ok := req.scheduleInput.bind(c)
+	if !ok {
+		return
+	}
+	currency, ok := bindCurrency(c, req.Currency)
+	if !ok {
+		return
+	}
+	if req.AccountID != nil {
+		accountCurrency, ok := h.bindAccount(c, userID, *req.AccountID)
+		if !ok {
+			return
+		}
+		if currency == nil {
+			currency = &accountCurrency
+		}
+	}
 
-	var item models.MonthlyExpense
-	err := h.DB.QueryRow(
-		`INSERT INTO monthly_expenses (user_id, name, tag, amount)
-		 VALUES ($1, $2, $3, $4)
-		 RETURNING id, user_id, name, tag, amount, last_applied_at, last_applied_expense_id`,
-		userID, req.Name, req.Tag, req.Amount,
-	).Scan(&item.ID, &item.UserID, &item.Name, &item.Tag, &item.Amount, &item.LastAppliedAt, &item.LastExpenseID)
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la creación del gasto recurrente", err)
+		return
+	}
+	defer tx.Rollback()
+
+	tag, ok := bindCategory(c, tx, userID, req.Tag)
+	if !ok {
+		return
+	}
+
+	item, err := scanMonthlyExpense(tx.QueryRowContext(c,
+		`INSERT INTO monthly_expenses (user_id, name, tag, amount, auto_apply, frequency, day_of_month, starts_on, ends_on, max_occurrences, currency, account_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE($11, (SELECT base_currency FROM users WHERE id=$1)), $12)
+		 RETURNING `+monthlyExpenseColumns,
+		userID, req.Name, tag, req.Amount, req.AutoApply, req.Frequency, req.DayOfMonth, startsOn, endsOn, req.MaxOccurrences, currency, req.AccountID,
+	))
 	if err != nil {
 		respondError(c, http.StatusInternalServerError, "No se pudo guardar el gasto recurrente", err)
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la creación del gasto recurrente", err)
+		return
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"monthlyExpense": item})
 }
 
+func (h *Handler) UpdateMonthlyExpense(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	itemID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del gasto recurrente no es válido", err)
+		return
+	}
+
+	var req struct {
+		Name      *string       `json:"name" binding:"omitempty,min=1"`
+		Tag       *string       `json:"tag" binding:"omitempty,min=1"`
+		Amount    *models.Money `json:"amount" binding:"omitempty,gt=0"`
+		Currency  *string       `json:"currency"`
+		AccountID *int64        `json:"accountId" binding:"omitempty,min=0"`
+		scheduleUpdate
+		// ApplyToCurrentMonth propaga los cambios al gasto ya generado en el
+		// período actual (el mes, para las plantillas mensuales).
+		ApplyToCurrentMonth bool `json:"applyToCurrentMonth"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos del gasto recurrente no son válidos", err)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la actualización del gasto recurrente", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var set updateSet
+	if req.Name != nil {
+		set.add("name", *req.Name)
+	}
+	if req.Tag != nil {
+		tag, ok := bindCategory(c, tx, userID, *req.Tag)
+		if !ok {
+			return
+		}
+		set.add("tag", tag)
+	}
+	if req.Amount != nil {
+		set.add("amount", *req.Amount)
+	}
+	if req.Currency != nil {
+		currency, ok := bindCurrency(c, *req.Currency)
+		if !ok {
+			return
+		}
+		if currency != nil {
+			set.add("currency", *currency)
+		}
+	}
+	if req.AccountID != nil {
+		if !h.bindOptionalAccount(c, userID, req.AccountID) {
+			return
+		}
+		set.add("account_id", accountArg(*req.AccountID))
+	}
+	expenseFields := len(set.assignments)
+	if !req.scheduleUpdate.addTo(c, &set) {
+		return
+	}
+	if set.empty() {
+		respondValidationError(c, "No se enviaron campos para actualizar", nil)
+		return
+	}
+
+	item, err := scanMonthlyExpense(tx.QueryRow(
+		fmt.Sprintf(
+			`UPDATE monthly_expenses
+			 SET %s
+			 WHERE id=$%d AND user_id=$%d
+			 RETURNING `+monthlyExpenseColumns,
+			set.clause(), set.next(), set.next()+1,
+		),
+		set.argsWith(itemID, userID)...,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el gasto recurrente solicitado", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el gasto recurrente", err)
+		return
+	}
+	if message := validateStoredSchedule(item); message != "" {
+		respondValidationError(c, message, nil)
+		return
+	}
+
+	response := gin.H{"monthlyExpense": item}
+
+	if req.ApplyToCurrentMonth && item.AppliedInPeriod(time.Now()) && item.LastExpenseID != nil && expenseFields > 0 {
+		// Solo name, tag, amount, currency y account_id se copian al gasto; el
+		// resto es propio de la plantilla.
+		expenseSet := updateSet{
+			assignments: set.assignments[:expenseFields],
+			args:        set.args[:expenseFields],
+		}
+		exp, err := scanExpense(tx.QueryRow(
+			fmt.Sprintf(
+				`UPDATE expenses
+				 SET %s, updated_at=now()
+				 WHERE id=$%d AND user_id=$%d
+				 RETURNING `+expenseColumns,
+				expenseSet.clause(), expenseSet.next(), expenseSet.next()+1,
+			),
+			expenseSet.argsWith(*item.LastExpenseID, userID)...,
+		))
+		if err != nil && err != sql.ErrNoRows {
+			respondError(c, http.StatusInternalServerError, "No se pudo actualizar el gasto del mes actual", err)
+			return
+		}
+		if err == nil {
+			response["expense"] = exp
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la actualización del gasto recurrente", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 func (h *Handler) DeleteMonthlyExpense(c *gin.Context) {
 	userID := c.GetInt64("userID")
 	idParam := c.Param("id")
@@ -102,6 +314,44 @@ func (h *Handler) DeleteMonthlyExpense(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// PauseMonthlyExpense deja de considerar pendiente a la plantilla sin
+// borrar su historial.
+func (h *Handler) PauseMonthlyExpense(c *gin.Context) {
+	h.setMonthlyExpensePaused(c, true)
+}
+
+func (h *Handler) ResumeMonthlyExpense(c *gin.Context) {
+	h.setMonthlyExpensePaused(c, false)
+}
+
+func (h *Handler) setMonthlyExpensePaused(c *gin.Context, paused bool) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	itemID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del gasto recurrente no es válido", err)
+		return
+	}
+
+	item, err := scanMonthlyExpense(h.DB.QueryRow(
+		`UPDATE monthly_expenses
+		 SET paused=$1
+		 WHERE id=$2 AND user_id=$3
+		 RETURNING `+monthlyExpenseColumns,
+		paused, itemID, userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el gasto recurrente solicitado", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el gasto recurrente", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"monthlyExpense": item})
+}
+
 func (h *Handler) ApplyMonthlyExpense(c *gin.Context) {
 	userID := c.GetInt64("userID")
 	itemIDStr := c.Param("id")
@@ -111,15 +361,22 @@ func (h *Handler) ApplyMonthlyExpense(c *gin.Context) {
 		return
 	}
 
-	var item models.MonthlyExpense
-	var lastApplied sql.NullTime
-	var lastExpense sql.NullInt64
-	err = h.DB.QueryRow(
-		`SELECT id, user_id, name, tag, amount, last_applied_at, last_applied_expense_id
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la operación de aplicación", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// El bloqueo de fila evita aplicar dos veces la plantilla si el
+	// scheduler la está aplicando en paralelo.
+	item, err := scanMonthlyExpense(tx.QueryRowContext(c,
+		`SELECT `+monthlyExpenseColumns+`
 		 FROM monthly_expenses
-		 WHERE id=$1 AND user_id=$2`,
+		 WHERE id=$1 AND user_id=$2
+		 FOR UPDATE`,
 		itemID, userID,
-	).Scan(&item.ID, &item.UserID, &item.Name, &item.Tag, &item.Amount, &lastApplied, &lastExpense)
+	))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondError(c, http.StatusNotFound, "No se encontró el gasto recurrente", nil)
@@ -130,56 +387,404 @@ func (h *Handler) ApplyMonthlyExpense(c *gin.Context) {
 	}
 
 	now := time.Now()
-	if lastApplied.Valid {
-		item.LastAppliedAt = &lastApplied.Time
-		if lastApplied.Time.Year() == now.Year() && lastApplied.Time.Month() == now.Month() {
-			respondError(c, http.StatusBadRequest, "Este gasto recurrente ya se aplicó en el mes actual", nil)
+	if reason := applyBlockReason(item, now); reason != "" {
+		respondError(c, http.StatusBadRequest, reason, nil)
+		return
+	}
+
+	exp, err := applyMonthlyExpense(c, tx, &item, expenseDateFor(item, now), now)
+	if err != nil {
+		respondApplyError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la aplicación del gasto recurrente", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"expense":        exp,
+		"monthlyExpense": item,
+	})
+}
+
+// ApplyDueMonthlyExpensesNow aplica en una sola transacción todas las
+// plantillas del usuario que todavía no se aplicaron en su período actual. Las
+// que no se pueden aplicar se informan en "skipped" con el motivo.
+func (h *Handler) ApplyDueMonthlyExpensesNow(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la operación de aplicación", err)
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(c,
+		`SELECT `+monthlyExpenseColumns+`
+		 FROM monthly_expenses
+		 WHERE user_id=$1
+		 ORDER BY id
+		 FOR UPDATE`,
+		userID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de gastos mensuales", err)
+		return
+	}
+	var items []models.MonthlyExpense
+	for rows.Next() {
+		item, err := scanMonthlyExpense(rows)
+		if err != nil {
+			rows.Close()
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de gastos mensuales", err)
 			return
 		}
+		items = append(items, item)
 	}
-	if lastExpense.Valid {
-		id := lastExpense.Int64
-		item.LastExpenseID = &id
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de gastos mensuales", err)
+		return
+	}
+
+	now := time.Now()
+	created := []models.Expense{}
+	skipped := []models.SkippedMonthlyExpense{}
+	for i := range items {
+		item := &items[i]
+		if reason := applyBlockReason(*item, now); reason != "" {
+			skipped = append(skipped, models.SkippedMonthlyExpense{ID: item.ID, Name: item.Name, Reason: reason})
+			continue
+		}
+		exp, err := applyMonthlyExpense(c, tx, item, expenseDateFor(*item, now), now)
+		if err != nil {
+			respondApplyError(c, err)
+			return
+		}
+		created = append(created, exp)
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la aplicación de los gastos recurrentes", err)
+		return
+	}
+
+	status := http.StatusOK
+	if len(created) > 0 {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{
+		"expenses": created,
+		"skipped":  skipped,
+	})
+}
+
+// UndoMonthlyExpenseApplication borra el gasto generado por la última
+// aplicación de la plantilla y restaura la aplicación anterior. Se rechaza si
+// el gasto generado fue editado después de crearse.
+func (h *Handler) UndoMonthlyExpenseApplication(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	itemIDStr := c.Param("id")
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del gasto recurrente no es válido", err)
+		return
 	}
 
 	tx, err := h.DB.BeginTx(c, nil)
 	if err != nil {
-		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la operación de aplicación", err)
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la operación", err)
 		return
 	}
 	defer tx.Rollback()
 
-	var exp models.Expense
-	expenseDate := now.Format("2006-01-02")
-	err = tx.QueryRow(
-		`INSERT INTO expenses (user_id, name, tag, amount, expense_date)
-		 VALUES ($1, $2, $3, $4, $5)
-		 RETURNING id, user_id, name, tag, amount, expense_date`,
-		userID, item.Name, item.Tag, item.Amount, expenseDate,
-	).Scan(&exp.ID, &exp.UserID, &exp.Name, &exp.Tag, &exp.Amount, &exp.Date)
+	item, err := scanMonthlyExpense(tx.QueryRowContext(c,
+		`SELECT `+monthlyExpenseColumns+`
+		 FROM monthly_expenses
+		 WHERE id=$1 AND user_id=$2
+		 FOR UPDATE`,
+		itemID, userID,
+	))
 	if err != nil {
-		respondError(c, http.StatusInternalServerError, "No se pudo crear el gasto a partir del recurrente", err)
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el gasto recurrente", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo recuperar el gasto recurrente", err)
+		return
+	}
+	if item.LastExpenseID == nil {
+		respondError(c, http.StatusBadRequest, "Este gasto recurrente no tiene una aplicación para deshacer", nil)
+		return
+	}
+	expenseID := *item.LastExpenseID
+
+	var updatedAt sql.NullTime
+	err = tx.QueryRowContext(c,
+		`SELECT updated_at FROM expenses WHERE id=$1 AND user_id=$2 FOR UPDATE`,
+		expenseID, userID,
+	).Scan(&updatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el gasto generado por la última aplicación", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo recuperar el gasto generado", err)
+		return
+	}
+	if updatedAt.Valid {
+		respondError(c, http.StatusConflict, "El gasto generado fue modificado y no se puede deshacer la aplicación", nil)
+		return
+	}
+
+	if err := restoreLastApplication(c, tx, userID, expenseID); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo restaurar la aplicación anterior", err)
+		return
+	}
+
+	if _, err := tx.ExecContext(c, `DELETE FROM expenses WHERE id=$1 AND user_id=$2`, expenseID, userID); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo eliminar el gasto generado", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la operación", err)
 		return
 	}
 
-	_, err = tx.Exec(
+	c.Status(http.StatusNoContent)
+}
+
+// applyMonthlyExpense crea el gasto con fecha expenseDate a partir de la
+// plantilla y la marca como aplicada en appliedAt dentro de tx. Actualiza item
+// con los nuevos datos de aplicación.
+func applyMonthlyExpense(ctx context.Context, tx *sql.Tx, item *models.MonthlyExpense, expenseDate, appliedAt time.Time) (models.Expense, error) {
+	exp, err := scanExpense(tx.QueryRowContext(ctx,
+		`INSERT INTO expenses (user_id, name, tag, amount, expense_date, currency, account_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+expenseColumns,
+		item.UserID, item.Name, item.Tag, item.Amount, expenseDate.Format("2006-01-02"), item.Currency, item.AccountID,
+	))
+	if err != nil {
+		return exp, &applyError{"No se pudo crear el gasto a partir del recurrente", err}
+	}
+
+	_, err = tx.ExecContext(ctx,
 		`UPDATE monthly_expenses SET last_applied_at=$1, last_applied_expense_id=$2 WHERE id=$3 AND user_id=$4`,
-		now, exp.ID, itemID, userID,
+		appliedAt, exp.ID, item.ID, item.UserID,
+	)
+	if err != nil {
+		return exp, &applyError{"No se pudo marcar el gasto recurrente como aplicado", err}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO monthly_expense_applications (monthly_expense_id, expense_id, applied_at) VALUES ($1, $2, $3)`,
+		item.ID, exp.ID, appliedAt,
+	)
+	if err != nil {
+		return exp, &applyError{"No se pudo registrar la aplicación del gasto recurrente", err}
+	}
+
+	item.LastAppliedAt = &appliedAt
+	item.LastExpenseID = &exp.ID
+	item.Occurrences++
+	item.Due = item.IsDue(time.Now())
+	return exp, nil
+}
+
+// ApplyDueMonthlyExpenses aplica, para todos los usuarios, cada plantilla con
+// auto_apply que todavía no se aplicó en el período actual. Cada plantilla se
+// vuelve a verificar con un bloqueo de fila para no duplicarla si el usuario
+// la aplicó a mano en paralelo.
+func (h *Handler) ApplyDueMonthlyExpenses(ctx context.Context) (int, error) {
+	return h.applyDueTemplates(ctx,
+		`SELECT id FROM monthly_expenses WHERE auto_apply AND NOT paused ORDER BY id`,
+		"recurring expense", applyDueMonthlyExpense,
 	)
+}
+
+func applyDueMonthlyExpense(ctx context.Context, tx *sql.Tx, id int64, now time.Time) (bool, error) {
+	item, err := scanMonthlyExpense(tx.QueryRowContext(ctx,
+		`SELECT `+monthlyExpenseColumns+`
+		 FROM monthly_expenses
+		 WHERE id=$1 AND auto_apply
+		 FOR UPDATE`, id,
+	))
 	if err != nil {
-		respondError(c, http.StatusInternalServerError, "No se pudo marcar el gasto recurrente como aplicado", err)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	if applyBlockReason(item, now) != "" {
+		return false, nil
+	}
+
+	if _, err := applyMonthlyExpense(ctx, tx, &item, expenseDateFor(item, now), now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *Handler) CatchUpMonthlyExpense(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	itemID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del gasto recurrente no es válido", err)
 		return
 	}
+	dryRun := c.Query("dryRun") == "true"
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la recuperación de períodos", err)
+		return
+	}
+	defer tx.Rollback()
+
+	item, err := scanMonthlyExpense(tx.QueryRow(
+		`SELECT `+monthlyExpenseColumns+`
+		 FROM monthly_expenses
+		 WHERE id=$1 AND user_id=$2
+		 FOR UPDATE`,
+		itemID, userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el gasto recurrente", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo recuperar el gasto recurrente", err)
+		return
+	}
+	if item.Paused {
+		respondError(c, http.StatusBadRequest, "Este gasto recurrente está pausado", nil)
+		return
+	}
+
+	dates := item.MissedOccurrences(time.Now())
+
+	if dryRun {
+		pending := []models.Expense{}
+		for _, date := range dates {
+			pending = append(pending, models.Expense{
+				UserID:    userID,
+				Name:      item.Name,
+				Tag:       item.Tag,
+				Amount:    item.Amount,
+				Date:      date.Format("2006-01-02"),
+				Currency:  item.Currency,
+				AccountID: item.AccountID,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"dryRun":         true,
+			"expenses":       pending,
+			"monthlyExpense": item,
+		})
+		return
+	}
+
+	created := []models.Expense{}
+	for _, date := range dates {
+		// Cada período queda marcado con su propia fecha para que el
+		// control de "ya aplicado" refleje el último período cubierto.
+		exp, err := applyMonthlyExpense(c, tx, &item, date, date)
+		if err != nil {
+			respondApplyError(c, err)
+			return
+		}
+		created = append(created, exp)
+	}
 
 	if err := tx.Commit(); err != nil {
-		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la aplicación del gasto recurrente", err)
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la recuperación de períodos", err)
 		return
 	}
 
-	item.LastAppliedAt = &now
-	item.LastExpenseID = &exp.ID
-	c.JSON(http.StatusCreated, gin.H{
-		"expense":        exp,
+	status := http.StatusOK
+	if len(created) > 0 {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{
+		"dryRun":         false,
+		"expenses":       created,
 		"monthlyExpense": item,
 	})
 }
+
+// restoreLastApplication hace que las plantillas cuya última aplicación es
+// expenseID apunten a la aplicación anterior, o a ninguna si no la hay. Debe
+// ejecutarse antes de borrar el gasto.
+func restoreLastApplication(ctx context.Context, tx *sql.Tx, userID, expenseID int64) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE monthly_expenses m
+		 SET (last_applied_at, last_applied_expense_id) = (
+		   SELECT a.applied_at, a.expense_id
+		   FROM monthly_expense_applications a
+		   WHERE a.monthly_expense_id = m.id AND a.expense_id <> $2
+		   ORDER BY a.applied_at DESC, a.id DESC
+		   LIMIT 1
+		 )
+		 WHERE m.user_id=$1 AND m.last_applied_expense_id=$2`,
+		userID, expenseID,
+	)
+	return err
+}
+
+func (h *Handler) MonthlyExpenseHistory(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	itemID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del gasto recurrente no es válido", err)
+		return
+	}
+
+	var exists bool
+	if err := h.DB.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM monthly_expenses WHERE id=$1 AND user_id=$2)`, itemID, userID,
+	).Scan(&exists); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo recuperar el gasto recurrente", err)
+		return
+	}
+	if !exists {
+		respondError(c, http.StatusNotFound, "No se encontró el gasto recurrente", nil)
+		return
+	}
+
+	rows, err := h.DB.Query(
+		`SELECT a.id, a.monthly_expense_id, a.applied_at,
+		        e.id, e.user_id, e.name, e.tag, e.amount, e.expense_date, e.currency
+		 FROM monthly_expense_applications a
+		 JOIN expenses e ON e.id = a.expense_id
+		 WHERE a.monthly_expense_id=$1 AND e.user_id=$2
+		 ORDER BY a.applied_at DESC, a.id DESC`,
+		itemID, userID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener el historial del gasto recurrente", err)
+		return
+	}
+	defer rows.Close()
+
+	history := []models.MonthlyExpenseApplication{}
+	for rows.Next() {
+		var app models.MonthlyExpenseApplication
+		var expenseDate time.Time
+		if err := rows.Scan(&app.ID, &app.MonthlyExpenseID, &app.AppliedAt,
+			&app.Expense.ID, &app.Expense.UserID, &app.Expense.Name, &app.Expense.Tag, &app.Expense.Amount, &expenseDate,
+			&app.Expense.Currency); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer el historial del gasto recurrente", err)
+			return
+		}
+		app.Expense.Date = expenseDate.Format("2006-01-02")
+		history = append(history, app)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
@@ -0,0 +1,439 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+const monthlyIncomeColumns = `id, user_id, source, tag, amount, currency, account_id, last_applied_at, last_applied_income_id, ` +
+	`auto_apply, frequency, day_of_month, starts_on, ends_on, paused, created_at, max_occurrences, ` +
+	`(SELECT COUNT(*) FROM monthly_income_applications a WHERE a.monthly_income_id = monthly_incomes.id) AS occurrences`
+
+func scanMonthlyIncome(row interface{ Scan(...interface{}) error }) (models.MonthlyIncome, error) {
+	var item models.MonthlyIncome
+	var lastApplied, startsOn, endsOn sql.NullTime
+	var accountID, lastIncome sql.NullInt64
+	var dayOfMonth, maxOccurrences sql.NullInt32
+	if err := row.Scan(&item.ID, &item.UserID, &item.Source, &item.Tag, &item.Amount, &item.Currency, &accountID,
+		&lastApplied, &lastIncome, &item.AutoApply, &item.Frequency, &dayOfMonth,
+		&startsOn, &endsOn, &item.Paused, &item.CreatedAt, &maxOccurrences, &item.Occurrences); err != nil {
+		return item, err
+	}
+	if accountID.Valid {
+		id := accountID.Int64
+		item.AccountID = &id
+	}
+	if lastApplied.Valid {
+		item.LastAppliedAt = &lastApplied.Time
+	}
+	if lastIncome.Valid {
+		id := lastIncome.Int64
+		item.LastIncomeID = &id
+	}
+	if dayOfMonth.Valid {
+		day := int(dayOfMonth.Int32)
+		item.DayOfMonth = &day
+	}
+	if startsOn.Valid {
+		item.StartsOn = &startsOn.Time
+	}
+	if endsOn.Valid {
+		item.EndsOn = &endsOn.Time
+	}
+	if maxOccurrences.Valid {
+		limit := int(maxOccurrences.Int32)
+		item.MaxOccurrences = &limit
+	}
+	item.Due = item.IsDue(time.Now())
+	return item, nil
+}
+
+func (h *Handler) ListMonthlyIncomes(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	rows, err := h.DB.Query(
+		`SELECT `+monthlyIncomeColumns+`
+		 FROM monthly_incomes
+		 WHERE user_id=$1
+		 ORDER BY id DESC`, userID,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de ingresos recurrentes", err)
+		return
+	}
+	defer rows.Close()
+
+	monthly := []models.MonthlyIncome{}
+	for rows.Next() {
+		item, err := scanMonthlyIncome(rows)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de ingresos recurrentes", err)
+			return
+		}
+		monthly = append(monthly, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"monthlyIncomes": monthly})
+}
+
+func (h *Handler) CreateMonthlyIncome(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	var req struct {
+		Source string       `json:"source" binding:"required"`
+		Tag    string       `json:"tag" binding:"required"`
+		Amount models.Money `json:"amount" binding:"required,gt=0"`
+		scheduleInput
+		Currency  string `json:"currency"`
+		AccountID *int64 `json:"accountId" binding:"omitempty,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos del ingreso recurrente no son válidos", err)
+		return
+	}
+	startsOn, endsOn, ok := req.scheduleInput.bind(c)
+	if !ok {
+		return
+	}
+	currency, ok := bindCurrency(c, req.Currency)
+	if !ok {
+		return
+	}
+	if req.AccountID != nil {
+		accountCurrency, ok := h.bindAccount(c, userID, *req.AccountID)
+		if !ok {
+			return
+		}
+		if currency == nil {
+			currency = &accountCurrency
+		}
+	}
+
+	item, err := scanMonthlyIncome(h.DB.QueryRow(
+		`INSERT INTO monthly_incomes (user_id, source, tag, amount, auto_apply, frequency, day_of_month, starts_on, ends_on, max_occurrences, currency, account_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE($11, (SELECT base_currency FROM users WHERE id=$1)), $12)
+		 RETURNING `+monthlyIncomeColumns,
+		userID, req.Source, req.Tag, req.Amount, req.AutoApply, req.Frequency, req.DayOfMonth, startsOn, endsOn, req.MaxOccurrences, currency, req.AccountID,
+	))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo guardar el ingreso recurrente", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"monthlyIncome": item})
+}
+
+func (h *Handler) UpdateMonthlyIncome(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	itemID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del ingreso recurrente no es válido", err)
+		return
+	}
+
+	var req struct {
+		Source    *string       `json:"source" binding:"omitempty,min=1"`
+		Tag       *string       `json:"tag" binding:"omitempty,min=1"`
+		Amount    *models.Money `json:"amount" binding:"omitempty,gt=0"`
+		Currency  *string       `json:"currency"`
+		AccountID *int64        `json:"accountId" binding:"omitempty,min=0"`
+		scheduleUpdate
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos del ingreso recurrente no son válidos", err)
+		return
+	}
+
+	var set updateSet
+	if req.Source != nil {
+		set.add("source", *req.Source)
+	}
+	if req.Tag != nil {
+		set.add("tag", *req.Tag)
+	}
+	if req.Amount != nil {
+		set.add("amount", *req.Amount)
+	}
+	if req.Currency != nil {
+		currency, ok := bindCurrency(c, *req.Currency)
+		if !ok {
+			return
+		}
+		if currency != nil {
+			set.add("currency", *currency)
+		}
+	}
+	if req.AccountID != nil {
+		if !h.bindOptionalAccount(c, userID, req.AccountID) {
+			return
+		}
+		set.add("account_id", accountArg(*req.AccountID))
+	}
+	if !req.scheduleUpdate.addTo(c, &set) {
+		return
+	}
+	if set.empty() {
+		respondValidationError(c, "No se enviaron campos para actualizar", nil)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la actualización del ingreso recurrente", err)
+		return
+	}
+	defer tx.Rollback()
+
+	item, err := scanMonthlyIncome(tx.QueryRow(
+		fmt.Sprintf(
+			`UPDATE monthly_incomes
+			 SET %s
+			 WHERE id=$%d AND user_id=$%d
+			 RETURNING `+monthlyIncomeColumns,
+			set.clause(), set.next(), set.next()+1,
+		),
+		set.argsWith(itemID, userID)...,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el ingreso recurrente solicitado", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el ingreso recurrente", err)
+		return
+	}
+	if message := validateStoredSchedule(item.Recurrence()); message != "" {
+		respondValidationError(c, message, nil)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la actualización del ingreso recurrente", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"monthlyIncome": item})
+}
+
+func (h *Handler) DeleteMonthlyIncome(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	itemID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del ingreso recurrente no es válido", err)
+		return
+	}
+
+	result, err := h.DB.Exec(`DELETE FROM monthly_incomes WHERE id=$1 AND user_id=$2`, itemID, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo eliminar el ingreso recurrente", err)
+		return
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la eliminación del ingreso recurrente", err)
+		return
+	}
+	if rows == 0 {
+		respondError(c, http.StatusNotFound, "No se encontró el ingreso recurrente solicitado", nil)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PauseMonthlyIncome deja de considerar pendiente a la plantilla sin borrar
+// sus ingresos, igual que PauseMonthlyExpense.
+func (h *Handler) PauseMonthlyIncome(c *gin.Context) {
+	h.setMonthlyIncomePaused(c, true)
+}
+
+func (h *Handler) ResumeMonthlyIncome(c *gin.Context) {
+	h.setMonthlyIncomePaused(c, false)
+}
+
+func (h *Handler) setMonthlyIncomePaused(c *gin.Context, paused bool) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	itemID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del ingreso recurrente no es válido", err)
+		return
+	}
+
+	item, err := scanMonthlyIncome(h.DB.QueryRow(
+		`UPDATE monthly_incomes
+		 SET paused=$1
+		 WHERE id=$2 AND user_id=$3
+		 RETURNING `+monthlyIncomeColumns,
+		paused, itemID, userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el ingreso recurrente solicitado", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo actualizar el ingreso recurrente", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"monthlyIncome": item})
+}
+
+func (h *Handler) ApplyMonthlyIncome(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	idParam := c.Param("id")
+	itemID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		respondValidationError(c, "El identificador del ingreso recurrente no es válido", err)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo iniciar la operación de aplicación", err)
+		return
+	}
+	defer tx.Rollback()
+
+	item, err := scanMonthlyIncome(tx.QueryRow(
+		`SELECT `+monthlyIncomeColumns+`
+		 FROM monthly_incomes
+		 WHERE id=$1 AND user_id=$2
+		 FOR UPDATE`,
+		itemID, userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "No se encontró el ingreso recurrente", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "No se pudo recuperar el ingreso recurrente", err)
+		return
+	}
+
+	now := time.Now()
+	if reason := monthlyIncomeBlockReason(item, now); reason != "" {
+		respondError(c, http.StatusBadRequest, reason, nil)
+		return
+	}
+
+	income, err := applyMonthlyIncome(c, tx, &item, now)
+	if err != nil {
+		respondApplyError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo confirmar la aplicación del ingreso recurrente", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"income":        income,
+		"monthlyIncome": item,
+	})
+}
+
+// monthlyIncomeBlockReason devuelve por qué la plantilla no puede aplicarse
+// ahora, o un string vacío si se puede aplicar.
+func monthlyIncomeBlockReason(item models.MonthlyIncome, now time.Time) string {
+	return scheduleBlockReason(item.Recurrence(), "ingreso recurrente", now)
+}
+
+// applyMonthlyIncome crea el ingreso del período actual a partir de la
+// plantilla y la marca como aplicada en now dentro de tx. Actualiza item con
+// los nuevos datos de aplicación.
+func applyMonthlyIncome(ctx context.Context, tx *sql.Tx, item *models.MonthlyIncome, now time.Time) (models.Income, error) {
+	income, err := scanIncome(tx.QueryRowContext(ctx,
+		`INSERT INTO incomes (user_id, source, tag, amount, income_date, currency, account_id, monthly_income_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 RETURNING `+incomeColumns,
+		item.UserID, item.Source, item.Tag, item.Amount, expenseDateFor(item.Recurrence(), now).Format("2006-01-02"),
+		item.Currency, item.AccountID, item.ID,
+	))
+	if err != nil {
+		return income, &applyError{"No se pudo crear el ingreso a partir del recurrente", err}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE monthly_incomes SET last_applied_at=$1, last_applied_income_id=$2 WHERE id=$3 AND user_id=$4`,
+		now, income.ID, item.ID, item.UserID,
+	)
+	if err != nil {
+		return income, &applyError{"No se pudo marcar el ingreso recurrente como aplicado", err}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO monthly_income_applications (monthly_income_id, income_id, applied_at) VALUES ($1, $2, $3)`,
+		item.ID, income.ID, now,
+	)
+	if err != nil {
+		return income, &applyError{"No se pudo registrar la aplicación del ingreso recurrente", err}
+	}
+
+	item.LastAppliedAt = &now
+	item.LastIncomeID = &income.ID
+	item.Occurrences++
+	item.Due = item.IsDue(time.Now())
+	return income, nil
+}
+
+// ApplyDueMonthlyIncomes aplica, para todos los usuarios, cada ingreso
+// recurrente con auto_apply que todavía no se aplicó en el período actual,
+// igual que ApplyDueMonthlyExpenses.
+func (h *Handler) ApplyDueMonthlyIncomes(ctx context.Context) (int, error) {
+	return h.applyDueTemplates(ctx,
+		`SELECT id FROM monthly_incomes WHERE auto_apply AND NOT paused ORDER BY id`,
+		"recurring income", applyDueMonthlyIncome,
+	)
+}
+
+func applyDueMonthlyIncome(ctx context.Context, tx *sql.Tx, id int64, now time.Time) (bool, error) {
+	item, err := scanMonthlyIncome(tx.QueryRowContext(ctx,
+		`SELECT `+monthlyIncomeColumns+`
+		 FROM monthly_incomes
+		 WHERE id=$1 AND auto_apply
+		 FOR UPDATE`, id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	if monthlyIncomeBlockReason(item, now) != "" {
+		return false, nil
+	}
+
+	if _, err := applyMonthlyIncome(ctx, tx, &item, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// restoreLastIncomeApplication hace lo mismo que restoreLastApplication para
+// los ingresos recurrentes cuya última aplicación es el ingreso incomeID.
+func restoreLastIncomeApplication(ctx context.Context, tx *sql.Tx, userID, incomeID int64) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE monthly_incomes m
+		 SET (last_applied_at, last_applied_income_id) = (
+		   SELECT a.applied_at, a.income_id
+		   FROM monthly_income_applications a
+		   WHERE a.monthly_income_id = m.id AND a.income_id <> $2
+		   ORDER BY a.applied_at DESC, a.id DESC
+		   LIMIT 1
+		 )
+		 WHERE m.user_id=$1 AND m.last_applied_income_id=$2`,
+		userID, incomeID,
+	)
+	return err
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
+)
+
+func monthlyIncomeRow(id int64, lastAppliedAt interface{}, createdAt time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows(strings.Split(monthlyIncomeColumns, ", ")).
+		AddRow(id, 1, "Empresa", "Sueldo", "1500000.00", "ARS", nil, lastAppliedAt, nil,
+			false, "monthly", 5, nil, nil, false, createdAt, nil, 0)
+}
+
+func TestApplyMonthlyIncome(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-incomes/:id/apply", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ApplyMonthlyIncome(c)
+	})
+
+	now := time.Now()
+	incomeDate := time.Date(now.Year(), now.Month(), 5, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM monthly_incomes\s+WHERE id=\$1 AND user_id=\$2\s+FOR UPDATE`).
+		WithArgs(int64(4), int64(1)).
+		WillReturnRows(monthlyIncomeRow(4, nil, now.AddDate(-1, 0, 0)))
+	mock.ExpectQuery("INSERT INTO incomes").
+		WithArgs(int64(1), "Empresa", "Sueldo", models.Money(150000000), incomeDate.Format("2006-01-02"), "ARS", nil, int64(4)).
+		WillReturnRows(sqlmock.NewRows(incomeColumnNames).
+			AddRow(10, 1, "Empresa", "Sueldo", "1500000.00", incomeDate, "ARS", nil, 4))
+	mock.ExpectExec(`UPDATE monthly_incomes SET last_applied_at=\$1, last_applied_income_id=\$2`).
+		WithArgs(sqlmock.AnyArg(), int64(10), int64(4), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO monthly_income_applications").
+		WithArgs(int64(4), int64(10), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest("POST", "/monthly-incomes/4/apply", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"lastIncomeId":10`)
+	assert.Contains(t, w.Body.String(), `"due":false`)
+	assert.Contains(t, w.Body.String(), `"occurrences":1`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyMonthlyIncome_AlreadyApplied(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-incomes/:id/apply", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ApplyMonthlyIncome(c)
+	})
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM monthly_incomes`).
+		WithArgs(int64(4), int64(1)).
+		WillReturnRows(monthlyIncomeRow(4, now, now.AddDate(-1, 0, 0)))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("POST", "/monthly-incomes/4/apply", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Este ingreso recurrente ya se aplicó en el mes actual")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyMonthlyIncome_Exhausted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-incomes/:id/apply", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ApplyMonthlyIncome(c)
+	})
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM monthly_incomes`).
+		WithArgs(int64(4), int64(1)).
+		WillReturnRows(sqlmock.NewRows(strings.Split(monthlyIncomeColumns, ", ")).
+			AddRow(4, 1, "Empresa", "Sueldo", "1500000.00", "ARS", nil, now.AddDate(0, -1, 0), nil,
+				false, "monthly", 5, nil, nil, false, now.AddDate(-1, 0, 0), 3, 3))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("POST", "/monthly-incomes/4/apply", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Este ingreso recurrente ya alcanzó su cantidad máxima de aplicaciones")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResumeMonthlyIncome(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-incomes/:id/resume", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ResumeMonthlyIncome(c)
+	})
+
+	mock.ExpectQuery(`UPDATE monthly_incomes\s+SET paused=\$1\s+WHERE id=\$2 AND user_id=\$3`).
+		WithArgs(false, int64(4), int64(1)).
+		WillReturnRows(monthlyIncomeRow(4, nil, time.Now().AddDate(-1, 0, 0)))
+
+	req, _ := http.NewRequest("POST", "/monthly-incomes/4/resume", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"paused":false`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
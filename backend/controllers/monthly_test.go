@@ -2,17 +2,45 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+
+	"gestor-gastos/models"
 )
 
+var selectMonthlyExpensesPattern = regexp.QuoteMeta("SELECT "+monthlyExpenseColumns) + `\s+FROM monthly_expenses`
+
+// monthlyExpenseRow returns a single monthly_expenses row for monthlyExpenseColumns,
+// filling the columns a test does not care about with their defaults.
+func monthlyExpenseRow(id int64, name, tag string, amount float64, lastApplied, lastExpense driver.Value) *sqlmock.Rows {
+	values := []driver.Value{id, int64(1), name, tag, amount, lastApplied, lastExpense}
+	values = append(values,
+		false,     // auto_apply
+		"monthly", // frequency
+		nil,       // day_of_month
+		time.Date(2023, 1, 15, 10, 0, 0, 0, time.UTC), // created_at
+		nil,      // starts_on
+		nil,      // ends_on
+		false,    // paused
+		nil,      // max_occurrences
+		"ARS",    // currency
+		nil,      // account_id
+		int64(0), // occurrences
+	)
+	return sqlmock.NewRows(strings.Split(monthlyExpenseColumns, ", ")).AddRow(values...)
+}
+
 func TestListMonthlyExpenses(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -27,10 +55,9 @@ func TestListMonthlyExpenses(t *testing.T) {
 		handler.ListMonthlyExpenses(c)
 	})
 
-	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, last_applied_at, last_applied_expense_id FROM monthly_expenses").
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
 		WithArgs(int64(1)).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "tag", "amount", "last_applied_at", "last_applied_expense_id"}).
-			AddRow(1, 1, "Rent", "Housing", 1000.0, nil, nil))
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, nil, nil))
 
 	req, _ := http.NewRequest("GET", "/monthly-expenses", nil)
 	w := httptest.NewRecorder()
@@ -56,10 +83,12 @@ func TestCreateMonthlyExpense(t *testing.T) {
 		handler.CreateMonthlyExpense(c)
 	})
 
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Housing")
 	mock.ExpectQuery("INSERT INTO monthly_expenses").
-		WithArgs(int64(1), "Rent", "Housing", 1000.0).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "tag", "amount", "last_applied_at", "last_applied_expense_id"}).
-			AddRow(1, 1, "Rent", "Housing", 1000.0, nil, nil))
+		WithArgs(int64(1), "Rent", "Housing", models.Money(100000), false, "monthly", nil, nil, nil, nil, nil, nil).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, nil, nil))
+	mock.ExpectCommit()
 
 	body := `{"name": "Rent", "tag": "Housing", "amount": 1000.0}`
 	req, _ := http.NewRequest("POST", "/monthly-expenses", bytes.NewBufferString(body))
@@ -190,19 +219,20 @@ func TestApplyMonthlyExpense_Success(t *testing.T) {
 	})
 
 	// Never applied before (nulls)
-	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, last_applied_at, last_applied_expense_id FROM monthly_expenses").
-		WithArgs(int64(1), int64(1)).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "tag", "amount", "last_applied_at", "last_applied_expense_id"}).
-			AddRow(1, 1, "Rent", "Housing", 1000.0, nil, nil))
-
 	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern+`\s+WHERE id=\$1 AND user_id=\$2\s+FOR UPDATE`).
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, nil, nil))
 	mock.ExpectQuery("INSERT INTO expenses").
-		WithArgs(int64(1), "Rent", "Housing", 1000.0, sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "tag", "amount", "expense_date"}).
-			AddRow(10, 1, "Rent", "Housing", 1000.0, "2023-12-09"))
+		WithArgs(int64(1), "Rent", "Housing", models.Money(100000), sqlmock.AnyArg(), "ARS", nil).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(10, 1, "Rent", "Housing", 1000.0, time.Date(2023, 12, 9, 0, 0, 0, 0, time.UTC), "ARS", nil, nil, nil))
 	mock.ExpectExec("UPDATE monthly_expenses SET last_applied_at").
 		WithArgs(sqlmock.AnyArg(), int64(10), int64(1), int64(1)).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO monthly_expense_applications").
+		WithArgs(int64(1), int64(10), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
 	req, _ := http.NewRequest("POST", "/monthly-expenses/1/apply", nil)
@@ -229,9 +259,11 @@ func TestApplyMonthlyExpense_NotFound(t *testing.T) {
 		handler.ApplyMonthlyExpense(c)
 	})
 
-	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, last_applied_at, last_applied_expense_id FROM monthly_expenses").
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
 		WithArgs(int64(999), int64(1)).
 		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
 
 	req, _ := http.NewRequest("POST", "/monthly-expenses/999/apply", nil)
 	w := httptest.NewRecorder()
@@ -259,10 +291,11 @@ func TestApplyMonthlyExpense_AlreadyAppliedThisMonth(t *testing.T) {
 
 	// Already applied this month
 	now := time.Now()
-	mock.ExpectQuery("SELECT id, user_id, name, tag, amount, last_applied_at, last_applied_expense_id FROM monthly_expenses").
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
 		WithArgs(int64(1), int64(1)).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "tag", "amount", "last_applied_at", "last_applied_expense_id"}).
-			AddRow(1, 1, "Rent", "Housing", 1000.0, now, int64(5)))
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, now, int64(5)))
+	mock.ExpectRollback()
 
 	req, _ := http.NewRequest("POST", "/monthly-expenses/1/apply", nil)
 	w := httptest.NewRecorder()
@@ -296,3 +329,736 @@ func TestApplyMonthlyExpense_InvalidID(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Contains(t, w.Body.String(), "El identificador del gasto recurrente no es válido")
 }
+
+func TestUpdateMonthlyExpense_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/monthly-expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateMonthlyExpense(c)
+	})
+
+	appliedAt := time.Now().AddDate(0, -1, 0)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE monthly_expenses\s+SET amount=\$1\s+WHERE id=\$2 AND user_id=\$3`).
+		WithArgs(models.Money(120000), int64(1), int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1200.0, appliedAt, int64(5)))
+	mock.ExpectCommit()
+
+	body := `{"amount": 1200}`
+	req, _ := http.NewRequest("PATCH", "/monthly-expenses/1", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "lastAppliedAt")
+	assert.NotContains(t, w.Body.String(), `"expense"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateMonthlyExpense_ApplyToCurrentMonth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/monthly-expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateMonthlyExpense(c)
+	})
+
+	// Already applied this month, so the generated expense is updated too
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE monthly_expenses").
+		WithArgs(models.Money(120000), int64(1), int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1200.0, time.Now(), int64(5)))
+	mock.ExpectQuery(`UPDATE expenses\s+SET amount=\$1, updated_at=now\(\)`).
+		WithArgs(models.Money(120000), int64(5), int64(1)).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(5, 1, "Rent", "Housing", 1200.0, time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectCommit()
+
+	body := `{"amount": 1200, "applyToCurrentMonth": true}`
+	req, _ := http.NewRequest("PATCH", "/monthly-expenses/1", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"expense"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateMonthlyExpense_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/monthly-expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateMonthlyExpense(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE monthly_expenses").
+		WithArgs("Alquiler", int64(999), int64(1)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	body := `{"name": "Alquiler"}`
+	req, _ := http.NewRequest("PATCH", "/monthly-expenses/999", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "No se encontró el gasto recurrente solicitado")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateMonthlyExpense_NoFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/monthly-expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateMonthlyExpense(c)
+	})
+
+	// The update runs in a transaction, which is rolled back when there is
+	// nothing to change.
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("PATCH", "/monthly-expenses/1", bytes.NewBufferString(`{"applyToCurrentMonth": true}`))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "No se enviaron campos para actualizar")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateMonthlyExpense_NegativeAmount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.PATCH("/monthly-expenses/:id", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UpdateMonthlyExpense(c)
+	})
+
+	req, _ := http.NewRequest("PATCH", "/monthly-expenses/1", bytes.NewBufferString(`{"amount": -1000}`))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Los datos del gasto recurrente no son válidos")
+}
+
+func TestApplyDueMonthlyExpenses(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+
+	mock.ExpectQuery("SELECT id FROM monthly_expenses WHERE auto_apply").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	// Template 1 was never applied, so it gets applied
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern + `\s+WHERE id=\$1 AND auto_apply\s+FOR UPDATE`).
+		WithArgs(int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, nil, nil))
+	mock.ExpectQuery("INSERT INTO expenses").
+		WithArgs(int64(1), "Rent", "Housing", models.Money(100000), sqlmock.AnyArg(), "ARS", nil).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(10, 1, "Rent", "Housing", 1000.0, time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectExec("UPDATE monthly_expenses SET last_applied_at").
+		WithArgs(sqlmock.AnyArg(), int64(10), int64(1), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO monthly_expense_applications").
+		WithArgs(int64(1), int64(10), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// Template 2 was already applied this month (e.g. manually), so it is skipped
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(2)).
+		WillReturnRows(monthlyExpenseRow(2, "Gym", "Health", 300.0, time.Now(), int64(7)))
+	mock.ExpectRollback()
+
+	applied, err := handler.ApplyDueMonthlyExpenses(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyDueMonthlyExpenses_ContinuesAfterFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+
+	mock.ExpectQuery("SELECT id FROM monthly_expenses WHERE auto_apply").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	// Template 1 fails to insert its expense
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, nil, nil))
+	mock.ExpectQuery("INSERT INTO expenses").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	// Template 2 is still applied
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(2)).
+		WillReturnRows(monthlyExpenseRow(2, "Gym", "Health", 300.0, nil, nil))
+	mock.ExpectQuery("INSERT INTO expenses").
+		WithArgs(int64(1), "Gym", "Health", models.Money(30000), sqlmock.AnyArg(), "ARS", nil).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(11, 1, "Gym", "Health", 300.0, time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectExec("UPDATE monthly_expenses SET last_applied_at").
+		WithArgs(sqlmock.AnyArg(), int64(11), int64(2), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO monthly_expense_applications").
+		WithArgs(int64(2), int64(11), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	applied, err := handler.ApplyDueMonthlyExpenses(context.Background())
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateMonthlyExpense_WithAutoApply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateMonthlyExpense(c)
+	})
+
+	mock.ExpectBegin()
+	expectCategory(mock, int64(1), "Housing")
+	mock.ExpectQuery("INSERT INTO monthly_expenses").
+		WithArgs(int64(1), "Rent", "Housing", models.Money(100000), true, "monthly", nil, nil, nil, nil, nil, nil).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, nil, nil))
+	mock.ExpectCommit()
+
+	body := `{"name": "Rent", "tag": "Housing", "amount": 1000.0, "autoApply": true}`
+	req, _ := http.NewRequest("POST", "/monthly-expenses", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateMonthlyExpense_InvalidSchedule(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateMonthlyExpense(c)
+	})
+
+	cases := map[string]string{
+		`{"name": "Rent", "tag": "Housing", "amount": 10, "frequency": "daily"}`:                   "La frecuencia debe ser",
+		`{"name": "Rent", "tag": "Housing", "amount": 10, "frequency": "weekly", "dayOfMonth": 5}`: "El día del mes solo aplica",
+		`{"name": "Rent", "tag": "Housing", "amount": 10, "dayOfMonth": 32}`:                       "Los datos del gasto recurrente no son válidos",
+	}
+	for body, message := range cases {
+		req, _ := http.NewRequest("POST", "/monthly-expenses", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Contains(t, w.Body.String(), message)
+	}
+}
+
+func TestExpenseDateFor(t *testing.T) {
+	now := time.Date(2024, 2, 10, 15, 30, 0, 0, time.UTC)
+	item := models.MonthlyExpense{Frequency: models.FrequencyMonthly, CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	// Without a fixed day the expense is dated today
+	assert.Equal(t, time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC), expenseDateFor(item, now))
+
+	day := 31
+	item.DayOfMonth = &day
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), expenseDateFor(item, now))
+}
+
+func TestApplyBlockReason_UsesFrequencyPeriod(t *testing.T) {
+	now := time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)
+	applied := time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC)
+	item := models.MonthlyExpense{
+		Frequency:     models.FrequencyQuarterly,
+		CreatedAt:     time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		LastAppliedAt: &applied,
+	}
+
+	// February-April quarter is over, May starts a new one
+	assert.Equal(t, "", applyBlockReason(item, now))
+
+	applied = time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "Este gasto recurrente ya se aplicó en el trimestre actual", applyBlockReason(item, now))
+}
+
+func TestCatchUpMonthlyExpense_DryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-expenses/:id/catch-up", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CatchUpMonthlyExpense(c)
+	})
+
+	// Last applied three months ago, so at least two full periods were missed
+	lastApplied := time.Now().AddDate(0, -3, 0)
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern+`\s+WHERE id=\$1 AND user_id=\$2\s+FOR UPDATE`).
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, lastApplied, int64(5)))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("POST", "/monthly-expenses/1/catch-up?dryRun=true", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"dryRun":true`)
+	assert.GreaterOrEqual(t, strings.Count(w.Body.String(), `"name":"Rent"`), 3)
+	assert.Equal(t, 0, strings.Count(w.Body.String(), `"currency":""`))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCatchUpMonthlyExpense_CreatesOneExpensePerPeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-expenses/:id/catch-up", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CatchUpMonthlyExpense(c)
+	})
+
+	item := models.MonthlyExpense{
+		Frequency: models.FrequencyMonthly,
+		CreatedAt: time.Date(2023, 1, 15, 10, 0, 0, 0, time.UTC),
+	}
+	lastApplied := time.Now().AddDate(0, -2, 0)
+	item.LastAppliedAt = &lastApplied
+	dates := item.MissedOccurrences(time.Now())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, lastApplied, int64(5)))
+	for i, date := range dates {
+		expenseID := int64(20 + i)
+		mock.ExpectQuery("INSERT INTO expenses").
+			WithArgs(int64(1), "Rent", "Housing", models.Money(100000), date.Format("2006-01-02"), "ARS", nil).
+			WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+				AddRow(expenseID, 1, "Rent", "Housing", 1000.0, date, "ARS", nil, nil, nil))
+		mock.ExpectExec("UPDATE monthly_expenses SET last_applied_at").
+			WithArgs(date, expenseID, int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO monthly_expense_applications").
+			WithArgs(int64(1), expenseID, date).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest("POST", "/monthly-expenses/1/catch-up", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.NotEmpty(t, dates)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, len(dates), strings.Count(w.Body.String(), `"tag":"Housing"`)-1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCatchUpMonthlyExpense_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-expenses/:id/catch-up", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CatchUpMonthlyExpense(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(9), int64(1)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("POST", "/monthly-expenses/9/catch-up", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMonthlyExpenseHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/monthly-expenses/:id/history", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.MonthlyExpenseHistory(c)
+	})
+
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("FROM monthly_expense_applications a").
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "monthly_expense_id", "applied_at", "id", "user_id", "name", "tag", "amount", "expense_date", "currency"}).
+			AddRow(2, 1, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), 11, 1, "Rent", "Housing", 1000.0, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), "ARS").
+			AddRow(1, 1, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 10, 1, "Rent", "Housing", 1000.0, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "ARS"))
+
+	req, _ := http.NewRequest("GET", "/monthly-expenses/1/history", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"date":"2024-02-01"`)
+	assert.Contains(t, w.Body.String(), `"date":"2024-01-01"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMonthlyExpenseHistory_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/monthly-expenses/:id/history", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.MonthlyExpenseHistory(c)
+	})
+
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(int64(9), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	req, _ := http.NewRequest("GET", "/monthly-expenses/9/history", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUndoMonthlyExpenseApplication_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.DELETE("/monthly-expenses/:id/apply", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UndoMonthlyExpenseApplication(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, time.Now(), int64(10)))
+	mock.ExpectQuery("SELECT updated_at FROM expenses").
+		WithArgs(int64(10), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(nil))
+	mock.ExpectExec(`UPDATE monthly_expenses m\s+SET \(last_applied_at, last_applied_expense_id\)`).
+		WithArgs(int64(1), int64(10)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM expenses").
+		WithArgs(int64(10), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest("DELETE", "/monthly-expenses/1/apply", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUndoMonthlyExpenseApplication_EditedExpense(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.DELETE("/monthly-expenses/:id/apply", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UndoMonthlyExpenseApplication(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, time.Now(), int64(10)))
+	mock.ExpectQuery("SELECT updated_at FROM expenses").
+		WithArgs(int64(10), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("DELETE", "/monthly-expenses/1/apply", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "fue modificado")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUndoMonthlyExpenseApplication_NeverApplied(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.DELETE("/monthly-expenses/:id/apply", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.UndoMonthlyExpenseApplication(c)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(monthlyExpenseRow(1, "Rent", "Housing", 1000.0, nil, nil))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("DELETE", "/monthly-expenses/1/apply", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyDueMonthlyExpensesNow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-expenses/apply-due", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ApplyDueMonthlyExpensesNow(c)
+	})
+
+	createdAt := time.Date(2023, 1, 15, 10, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(strings.Split(monthlyExpenseColumns, ", ")).
+			AddRow(1, 1, "Rent", "Housing", 1000.0, nil, nil, false, "monthly", nil, createdAt, nil, nil, false, nil, "ARS", nil, 0).
+			AddRow(2, 1, "Gym", "Health", 30.0, time.Now(), int64(7), false, "monthly", nil, createdAt, nil, nil, false, nil, "ARS", nil, 0))
+	mock.ExpectQuery("INSERT INTO expenses").
+		WithArgs(int64(1), "Rent", "Housing", models.Money(100000), sqlmock.AnyArg(), "ARS", nil).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(10, 1, "Rent", "Housing", 1000.0, time.Now(), "ARS", nil, nil, nil))
+	mock.ExpectExec("UPDATE monthly_expenses SET last_applied_at").
+		WithArgs(sqlmock.AnyArg(), int64(10), int64(1), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO monthly_expense_applications").
+		WithArgs(int64(1), int64(10), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	req, _ := http.NewRequest("POST", "/monthly-expenses/apply-due", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Rent"`)
+	assert.Contains(t, w.Body.String(), `"skipped":[{"id":2,"name":"Gym","reason":"Este gasto recurrente ya se aplicó en el mes actual"}]`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPauseMonthlyExpense(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-expenses/:id/pause", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.PauseMonthlyExpense(c)
+	})
+
+	createdAt := time.Date(2023, 1, 15, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("UPDATE monthly_expenses\\s+SET paused=\\$1").
+		WithArgs(true, int64(1), int64(1)).
+		WillReturnRows(sqlmock.NewRows(strings.Split(monthlyExpenseColumns, ", ")).
+			AddRow(1, 1, "Gym", "Health", 30.0, nil, nil, false, "monthly", nil, createdAt, nil, nil, true, nil, "ARS", nil, 4))
+
+	req, _ := http.NewRequest("POST", "/monthly-expenses/1/pause", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"paused":true`)
+	assert.Contains(t, w.Body.String(), `"due":false`)
+	assert.Contains(t, w.Body.String(), `"occurrences":4`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyMonthlyExpense_Paused(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-expenses/:id/apply", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.ApplyMonthlyExpense(c)
+	})
+
+	createdAt := time.Date(2023, 1, 15, 10, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectMonthlyExpensesPattern).
+		WithArgs(int64(1), int64(1)).
+		WillReturnRows(sqlmock.NewRows(strings.Split(monthlyExpenseColumns, ", ")).
+			AddRow(1, 1, "Gym", "Health", 30.0, nil, nil, false, "monthly", nil, createdAt, nil, nil, true, nil, "ARS", nil, 0))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("POST", "/monthly-expenses/1/apply", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Este gasto recurrente está pausado")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateMonthlyExpense_EndsBeforeStart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.POST("/monthly-expenses", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CreateMonthlyExpense(c)
+	})
+
+	body := `{"name": "Gym", "tag": "Health", "amount": 30, "startsOn": "2024-05-01", "endsOn": "2024-04-30"}`
+	req, _ := http.NewRequest("POST", "/monthly-expenses", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "La fecha de fin no puede ser anterior a la fecha de inicio")
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+type priceIndexInput struct {
+	Month string  `json:"month" binding:"required"`
+	Value float64 `json:"value" binding:"required,gt=0"`
+}
+
+// normalize valida el índice, deja el mes como su primer día y devuelve un
+// mensaje para el cliente si no es válido.
+func (in *priceIndexInput) normalize() string {
+	month, ok := parseIndexMonth(in.Month)
+	if !ok {
+		return "El mes debe usar el formato YYYY-MM"
+	}
+	if in.Value <= 0 {
+		return "El valor del índice debe ser mayor a cero"
+	}
+	in.Month = month.Format("2006-01-02")
+	return ""
+}
+
+// parseIndexMonth acepta YYYY-MM o una fecha YYYY-MM-DD, como las series de
+// INDEC, y devuelve el primer día del mes.
+func parseIndexMonth(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if month, err := parseMonth(value); err == nil {
+		return month, true
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC), true
+}
+
+func (h *Handler) ListPriceIndexes(c *gin.Context) {
+	var where whereBuilder
+	for _, bound := range []struct{ param, condition string }{
+		{"from", "month >= ?"},
+		{"to", "month <= ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		month, err := parseMonth(value)
+		if err != nil {
+			respondValidationError(c, "El parámetro '"+bound.param+"' debe usar el formato YYYY-MM", err)
+			return
+		}
+		where.add(bound.condition, month.Format("2006-01-02"))
+	}
+
+	query := `SELECT id, month, value FROM price_indexes`
+	if len(where.conditions) > 0 {
+		query += ` WHERE ` + where.clause()
+	}
+	query += ` ORDER BY month`
+
+	rows, err := h.DB.Query(query, where.args...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo obtener la lista de índices de precios", err)
+		return
+	}
+	defer rows.Close()
+
+	indexes := []models.PriceIndex{}
+	for rows.Next() {
+		var index models.PriceIndex
+		var month time.Time
+		if err := rows.Scan(&index.ID, &month, &index.Value); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer la lista de índices de precios", err)
+			return
+		}
+		index.Month = month.Format("2006-01")
+		indexes = append(indexes, index)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"priceIndexes": indexes})
+}
+
+// UpsertPriceIndexes guarda los índices enviados en JSON. Si ya existe uno
+// para el mismo mes, se reemplaza.
+func (h *Handler) UpsertPriceIndexes(c *gin.Context) {
+	var req struct {
+		Indexes []priceIndexInput `json:"indexes" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, "Los datos de los índices de precios no son válidos", err)
+		return
+	}
+	for i := range req.Indexes {
+		if message := req.Indexes[i].normalize(); message != "" {
+			respondValidationError(c, fmt.Sprintf("Índice %d: %s", i+1, message), nil)
+			return
+		}
+	}
+
+	if err := h.savePriceIndexes(c, req.Indexes); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron guardar los índices de precios", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"imported": len(req.Indexes)})
+}
+
+// ImportPriceIndexesCSV importa una serie mensual con dos columnas, mes y
+// valor, como la del IPC de INDEC. La primera fila es el encabezado. También
+// acepta archivos separados por punto y coma con coma decimal.
+func (h *Handler) ImportPriceIndexesCSV(c *gin.Context) {
+	body, ok := csvUpload(c)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	indexes, message, err := parsePriceIndexesCSV(body)
+	if message != "" {
+		respondValidationError(c, message, err)
+		return
+	}
+
+	if err := h.savePriceIndexes(c, indexes); err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudieron guardar los índices de precios", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"imported": len(indexes)})
+}
+
+// thousandsOnlyPattern reconoce valores como 7.694, donde el punto puede ser
+// tanto separador de miles como separador decimal.
+var thousandsOnlyPattern = regexp.MustCompile(`^\d{1,3}(\.\d{3})+$`)
+
+// parsePriceIndexesCSV lee y valida la serie. Si no es válida devuelve el
+// mensaje para el cliente, indicando la línea con el problema.
+func parsePriceIndexesCSV(r io.Reader) ([]priceIndexInput, string, error) {
+	buffered := bufio.NewReader(r)
+	firstLine, _ := buffered.Peek(buffered.Size())
+	if i := bytes.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+	semicolon := bytes.ContainsRune(firstLine, ';')
+
+	reader := csv.NewReader(buffered)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = 2
+	if semicolon {
+		reader.Comma = ';'
+	}
+
+	if _, err := reader.Read(); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, "El archivo CSV está vacío", nil
+		}
+		return nil, "El archivo CSV debe tener dos columnas: mes y valor", err
+	}
+
+	var indexes []priceIndexInput
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "El archivo CSV debe tener dos columnas: mes y valor", err
+		}
+		line, _ := reader.FieldPos(0)
+		raw := strings.TrimSpace(record[1])
+		// En los archivos separados por punto y coma los puntos solo se
+		// descartan como separadores de miles si el valor usa coma decimal.
+		if semicolon {
+			switch {
+			case strings.Contains(raw, ","):
+				raw = strings.ReplaceAll(strings.ReplaceAll(raw, ".", ""), ",", ".")
+			case thousandsOnlyPattern.MatchString(raw):
+				return nil, fmt.Sprintf("Línea %d: el valor %s es ambiguo; los decimales deben separarse con coma", line, raw), nil
+			}
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Sprintf("Línea %d: el valor del índice debe ser numérico", line), err
+		}
+		in := priceIndexInput{Month: record[0], Value: value}
+		if message := in.normalize(); message != "" {
+			return nil, fmt.Sprintf("Línea %d: %s", line, message), nil
+		}
+		indexes = append(indexes, in)
+	}
+	if len(indexes) == 0 {
+		return nil, "El archivo CSV no tiene índices de precios", nil
+	}
+	return indexes, "", nil
+}
+
+func (h *Handler) savePriceIndexes(ctx context.Context, indexes []priceIndexInput) error {
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO price_indexes (month, value) VALUES ($1, $2)
+		 ON CONFLICT (month) DO UPDATE SET value = EXCLUDED.value`,
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, index := range indexes {
+		if _, err := stmt.ExecContext(ctx, index.Month, index.Value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePriceIndexesCSV(t *testing.T) {
+	indexes, message, err := parsePriceIndexesCSV(strings.NewReader("indice_tiempo,ipc_ng_nacional\n2024-12-01,7694.0075\n2025-01,7864.1257\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, message)
+	assert.Equal(t, []priceIndexInput{
+		{Month: "2024-12-01", Value: 7694.0075},
+		{Month: "2025-01-01", Value: 7864.1257},
+	}, indexes)
+
+	indexes, message, err = parsePriceIndexesCSV(strings.NewReader("Mes;Índice\n2024-12;7.694,0075\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, message)
+	assert.Equal(t, []priceIndexInput{{Month: "2024-12-01", Value: 7694.0075}}, indexes)
+
+	// Without a decimal comma the dot is a decimal point, not a thousands separator.
+	indexes, message, err = parsePriceIndexesCSV(strings.NewReader("Mes;Índice\n2024-12;123.45\n2025-01;7694\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, message)
+	assert.Equal(t, []priceIndexInput{
+		{Month: "2024-12-01", Value: 123.45},
+		{Month: "2025-01-01", Value: 7694},
+	}, indexes)
+
+	_, message, _ = parsePriceIndexesCSV(strings.NewReader("Mes;Índice\n2024-12;7.694\n"))
+	assert.Equal(t, "Línea 2: el valor 7.694 es ambiguo; los decimales deben separarse con coma", message)
+
+	_, message, _ = parsePriceIndexesCSV(strings.NewReader("mes,valor\n2024-12,7694\ndiciembre,7700\n"))
+	assert.Equal(t, "Línea 3: El mes debe usar el formato YYYY-MM", message)
+}
+
+func TestImportPriceIndexesCSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.New()
+	router.POST("/price-indexes/csv", handler.ImportPriceIndexesCSV)
+
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare("INSERT INTO price_indexes")
+	prep.ExpectExec().WithArgs("2024-12-01", 7694.0075).WillReturnResult(sqlmock.NewResult(1, 1))
+	prep.ExpectExec().WithArgs("2025-01-01", 7864.1257).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	body := "indice_tiempo,ipc_ng_nacional\n2024-12-01,7694.0075\n2025-01-01,7864.1257\n"
+	req, _ := http.NewRequest("POST", "/price-indexes/csv", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"imported":2`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
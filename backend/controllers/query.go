@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"gestor-gastos/models"
+)
+
+// queryer es lo que tienen en común *sql.DB y *sql.Tx para consultar, de modo
+// que un helper pueda usarse dentro o fuera de una transacción.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// updateSet acumula asignaciones "columna=$n" para armar UPDATE parciales.
+type updateSet struct {
+	assignments []string
+	args        []interface{}
+}
+
+func (u *updateSet) add(column string, value interface{}) {
+	u.args = append(u.args, value)
+	u.assignments = append(u.assignments, fmt.Sprintf("%s=$%d", column, len(u.args)))
+}
+
+func (u *updateSet) empty() bool {
+	return len(u.assignments) == 0
+}
+
+func (u *updateSet) clause() string {
+	return strings.Join(u.assignments, ", ")
+}
+
+// argsWith devuelve una copia de los argumentos con valores extra al final,
+// de modo que el mismo updateSet pueda usarse en más de una sentencia.
+func (u *updateSet) argsWith(extra ...interface{}) []interface{} {
+	args := make([]interface{}, 0, len(u.args)+len(extra))
+	args = append(args, u.args...)
+	return append(args, extra...)
+}
+
+// next devuelve el número del próximo placeholder libre.
+func (u *updateSet) next() int {
+	return len(u.args) + 1
+}
+
+// whereBuilder arma condiciones parametrizadas unidas con AND. Cada '?' de la
+// condición se reemplaza por el siguiente placeholder posicional de Postgres.
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (w *whereBuilder) add(condition string, values ...interface{}) {
+	for _, value := range values {
+		w.args = append(w.args, value)
+		condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(w.args)), 1)
+	}
+	w.conditions = append(w.conditions, condition)
+}
+
+func (w *whereBuilder) clause() string {
+	return strings.Join(w.conditions, " AND ")
+}
+
+// nullableMoney convierte un monto opcional de un PATCH en el valor de la
+// columna: un 0 la deja en NULL.
+func nullableMoney(amount models.Money) interface{} {
+	if amount == 0 {
+		return nil
+	}
+	return amount
+}
+
+// isUniqueViolation indica si Postgres rechazó la sentencia por una restricción UNIQUE.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isCheckViolation indica si Postgres rechazó la sentencia por una restricción CHECK.
+func isCheckViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23514"
+}
+
+// isForeignKeyViolation indica si Postgres rechazó la sentencia por una clave foránea.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// parseMonth interpreta un mes en formato YYYY-MM y devuelve su primer día.
+func parseMonth(value string) (time.Time, error) {
+	return time.Parse("2006-01", value)
+}
+
+// parseCurrency valida un código de moneda ISO 4217 y lo devuelve en mayúsculas.
+func parseCurrency(value string) (string, bool) {
+	code := strings.ToUpper(strings.TrimSpace(value))
+	if len(code) != 3 {
+		return "", false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", false
+		}
+	}
+	return code, true
+}
@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+// Las plantillas de gastos y de ingresos recurrentes comparten el calendario,
+// las validaciones, los motivos de bloqueo y la aplicación desde el
+// scheduler. El calendario de ambas se representa con models.MonthlyExpense.
+
+// periodNames nombra el período de cada frecuencia en los mensajes al usuario.
+var periodNames = map[models.Frequency]string{
+	models.FrequencyWeekly:    "la semana actual",
+	models.FrequencyBiweekly:  "la quincena actual",
+	models.FrequencyMonthly:   "el mes actual",
+	models.FrequencyQuarterly: "el trimestre actual",
+	models.FrequencyYearly:    "el año actual",
+}
+
+func validateSchedule(frequency models.Frequency, dayOfMonth *int) string {
+	if !frequency.Valid() {
+		return "La frecuencia debe ser weekly, biweekly, monthly, quarterly o yearly"
+	}
+	if dayOfMonth != nil && !frequency.UsesDayOfMonth() {
+		return "El día del mes solo aplica a frecuencias mensuales, trimestrales o anuales"
+	}
+	return ""
+}
+
+func validateLifecycle(startsOn, endsOn *time.Time) string {
+	if startsOn != nil && endsOn != nil && endsOn.Before(*startsOn) {
+		return "La fecha de fin no puede ser anterior a la fecha de inicio"
+	}
+	return ""
+}
+
+// validateStoredSchedule valida el calendario de una plantilla ya actualizada,
+// ya que un cambio parcial puede dejar una combinación inválida.
+func validateStoredSchedule(schedule models.MonthlyExpense) string {
+	if message := validateSchedule(schedule.Frequency, schedule.DayOfMonth); message != "" {
+		return message
+	}
+	return validateLifecycle(schedule.StartsOn, schedule.EndsOn)
+}
+
+// scheduleInput son los campos de calendario de una plantilla nueva.
+type scheduleInput struct {
+	// AutoApply permite que el scheduler la aplique sin intervención del usuario.
+	AutoApply  bool             `json:"autoApply"`
+	Frequency  models.Frequency `json:"frequency"`
+	DayOfMonth *int             `json:"dayOfMonth" binding:"omitempty,min=1,max=31"`
+	// StartsOn y EndsOn usan el formato YYYY-MM-DD.
+	StartsOn       *string `json:"startsOn"`
+	EndsOn         *string `json:"endsOn"`
+	MaxOccurrences *int    `json:"maxOccurrences" binding:"omitempty,min=1"`
+}
+
+// bind completa la frecuencia por defecto, valida el calendario y devuelve las
+// fechas de inicio y fin. Si algo no es válido responde al cliente y devuelve
+// false.
+func (in *scheduleInput) bind(c *gin.Context) (startsOn, endsOn *time.Time, ok bool) {
+	if in.Frequency == "" {
+		in.Frequency = models.FrequencyMonthly
+	}
+	if message := validateSchedule(in.Frequency, in.DayOfMonth); message != "" {
+		respondValidationError(c, message, nil)
+		return nil, nil, false
+	}
+	if in.StartsOn != nil && *in.StartsOn != "" {
+		date, err := time.Parse("2006-01-02", *in.StartsOn)
+		if err != nil {
+			respondValidationError(c, "La fecha de inicio debe usar el formato YYYY-MM-DD", err)
+			return nil, nil, false
+		}
+		startsOn = &date
+	}
+	if in.EndsOn != nil && *in.EndsOn != "" {
+		date, err := time.Parse("2006-01-02", *in.EndsOn)
+		if err != nil {
+			respondValidationError(c, "La fecha de fin debe usar el formato YYYY-MM-DD", err)
+			return nil, nil, false
+		}
+		endsOn = &date
+	}
+	if message := validateLifecycle(startsOn, endsOn); message != "" {
+		respondValidationError(c, message, nil)
+		return nil, nil, false
+	}
+	return startsOn, endsOn, true
+}
+
+// scheduleUpdate son los campos de calendario que se pueden editar en una
+// plantilla existente.
+type scheduleUpdate struct {
+	AutoApply *bool             `json:"autoApply"`
+	Frequency *models.Frequency `json:"frequency"`
+	// Un 0 quita el día fijo y vuelve a usar la fecha de aplicación.
+	DayOfMonth *int `json:"dayOfMonth" binding:"omitempty,min=0,max=31"`
+	// Un string vacío quita la fecha y un 0 quita el máximo de aplicaciones.
+	StartsOn       *string `json:"startsOn"`
+	EndsOn         *string `json:"endsOn"`
+	MaxOccurrences *int    `json:"maxOccurrences" binding:"omitempty,min=0"`
+}
+
+// addTo agrega a set los campos enviados. Si alguno no es válido responde al
+// cliente y devuelve false.
+func (in *scheduleUpdate) addTo(c *gin.Context, set *updateSet) bool {
+	if in.AutoApply != nil {
+		set.add("auto_apply", *in.AutoApply)
+	}
+	if in.Frequency != nil {
+		if !in.Frequency.Valid() {
+			respondValidationError(c, "La frecuencia debe ser weekly, biweekly, monthly, quarterly o yearly", nil)
+			return false
+		}
+		set.add("frequency", *in.Frequency)
+	}
+	if in.DayOfMonth != nil {
+		if *in.DayOfMonth == 0 {
+			set.add("day_of_month", nil)
+		} else {
+			set.add("day_of_month", *in.DayOfMonth)
+		}
+	}
+	if in.StartsOn != nil {
+		if *in.StartsOn == "" {
+			set.add("starts_on", nil)
+		} else {
+			date, err := time.Parse("2006-01-02", *in.StartsOn)
+			if err != nil {
+				respondValidationError(c, "La fecha de inicio debe usar el formato YYYY-MM-DD", err)
+				return false
+			}
+			set.add("starts_on", date)
+		}
+	}
+	if in.EndsOn != nil {
+		if *in.EndsOn == "" {
+			set.add("ends_on", nil)
+		} else {
+			date, err := time.Parse("2006-01-02", *in.EndsOn)
+			if err != nil {
+				respondValidationError(c, "La fecha de fin debe usar el formato YYYY-MM-DD", err)
+				return false
+			}
+			set.add("ends_on", date)
+		}
+	}
+	if in.MaxOccurrences != nil {
+		if *in.MaxOccurrences == 0 {
+			set.add("max_occurrences", nil)
+		} else {
+			set.add("max_occurrences", *in.MaxOccurrences)
+		}
+	}
+	return true
+}
+
+// scheduleBlockReason devuelve por qué una plantilla con el calendario
+// schedule no puede aplicarse ahora, o un string vacío si se puede aplicar.
+// noun nombra la plantilla en el mensaje, por ejemplo "gasto recurrente".
+func scheduleBlockReason(schedule models.MonthlyExpense, noun string, now time.Time) string {
+	switch {
+	case schedule.Paused:
+		return "Este " + noun + " está pausado"
+	case schedule.NotStarted(now):
+		return "Este " + noun + " comienza el " + schedule.StartsOn.Format("2006-01-02")
+	case schedule.Ended(now):
+		return "Este " + noun + " finalizó el " + schedule.EndsOn.Format("2006-01-02")
+	case schedule.Exhausted():
+		return "Este " + noun + " ya alcanzó su cantidad máxima de aplicaciones"
+	}
+	if schedule.AppliedInPeriod(now) {
+		name, ok := periodNames[schedule.Frequency]
+		if !ok {
+			name = periodNames[models.FrequencyMonthly]
+		}
+		return "Este " + noun + " ya se aplicó en " + name
+	}
+	return ""
+}
+
+// applyBlockReason devuelve por qué la plantilla de gasto no puede aplicarse
+// ahora, o un string vacío si se puede aplicar.
+func applyBlockReason(item models.MonthlyExpense, now time.Time) string {
+	return scheduleBlockReason(item, "gasto recurrente", now)
+}
+
+// expenseDateFor devuelve la fecha del movimiento al aplicar la plantilla en
+// now: el día configurado dentro del período actual, o el día de hoy si no
+// tiene uno.
+func expenseDateFor(item models.MonthlyExpense, now time.Time) time.Time {
+	if item.DayOfMonth != nil && item.Frequency.UsesDayOfMonth() {
+		return item.OccurrenceDate(item.PeriodStart(now))
+	}
+	return models.Date(now)
+}
+
+// applyError conserva el mensaje para el cliente junto al error original.
+type applyError struct {
+	message string
+	err     error
+}
+
+func (e *applyError) Error() string {
+	return e.message + ": " + e.err.Error()
+}
+
+func (e *applyError) Unwrap() error {
+	return e.err
+}
+
+func respondApplyError(c *gin.Context, err error) {
+	var ae *applyError
+	if errors.As(err, &ae) {
+		respondError(c, http.StatusInternalServerError, ae.message, ae.err)
+		return
+	}
+	respondError(c, http.StatusInternalServerError, "No se pudo aplicar el gasto recurrente", err)
+}
+
+// applyDueTemplates aplica, cada una en su propia transacción, las plantillas
+// cuyos ids devuelve idsQuery. apply debe bloquear la fila de la plantilla,
+// volver a verificar que siga pendiente y aplicarla; devuelve false si ya no
+// corresponde aplicarla. Si una plantilla falla se registra el error y se
+// sigue con las demás, para que una sola plantilla rota no frene al resto.
+func (h *Handler) applyDueTemplates(ctx context.Context, idsQuery, label string,
+	apply func(ctx context.Context, tx *sql.Tx, id int64, now time.Time) (bool, error)) (int, error) {
+	rows, err := h.DB.QueryContext(ctx, idsQuery)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	applied, failed := 0, 0
+	for _, id := range ids {
+		ok, err := h.applyDueTemplate(ctx, id, apply)
+		if err != nil {
+			log.Printf("scheduler: %s %d: %v", label, id, err)
+			failed++
+			continue
+		}
+		if ok {
+			applied++
+		}
+	}
+	if failed > 0 {
+		return applied, fmt.Errorf("%d %s templates could not be applied", failed, label)
+	}
+	return applied, nil
+}
+
+func (h *Handler) applyDueTemplate(ctx context.Context, id int64,
+	apply func(ctx context.Context, tx *sql.Tx, id int64, now time.Time) (bool, error)) (bool, error) {
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ok, err := apply(ctx, tx, id, time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gestor-gastos/models"
+)
+
+// summaryPeriods mapea cada agrupación temporal a la unidad de date_trunc.
+var summaryPeriods = map[string]string{
+	"day":   "day",
+	"week":  "week",
+	"month": "month",
+}
+
+func (h *Handler) SpendingSummary(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var byTag, byCurrency bool
+	var period string
+	groupBy := []string{}
+	if groupParam := c.Query("groupBy"); groupParam != "" {
+		for _, key := range strings.Split(groupParam, ",") {
+			key = strings.TrimSpace(strings.ToLower(key))
+			switch {
+			case key == "tag" && !byTag:
+				byTag = true
+			case key == "currency" && !byCurrency:
+				byCurrency = true
+			case summaryPeriods[key] != "" && period == "":
+				period = summaryPeriods[key]
+			default:
+				respondValidationError(c, "El parámetro 'groupBy' acepta tag, currency y como máximo uno de day, week o month", nil)
+				return
+			}
+			groupBy = append(groupBy, key)
+		}
+	}
+
+	var where whereBuilder
+	where.add("user_id=?", userID)
+	if !applyExpenseFilters(c, &where) {
+		return
+	}
+
+	// Con adjust=real cada gasto se multiplica por el índice del mes base
+	// dividido el de su propio mes, de modo que los montos quedan en moneda
+	// constante del mes base. Los gastos de meses sin índice quedan afuera.
+	raw, converted := "amount", convertedAmountSQL
+	args := where.args
+	adjust := c.DefaultQuery("adjust", "nominal")
+	var base time.Time
+	switch adjust {
+	case "nominal":
+	case "real":
+		var err error
+		base, err = parseMonth(c.Query("base"))
+		if err != nil {
+			respondValidationError(c, "Con adjust=real el parámetro 'base' es obligatorio y debe usar el formato YYYY-MM", err)
+			return
+		}
+		var baseIndex string
+		err = h.DB.QueryRow(`SELECT value FROM price_indexes WHERE month=$1`, base.Format("2006-01-02")).Scan(&baseIndex)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondValidationError(c, "No hay un índice de precios cargado para el mes base "+base.Format("2006-01"), nil)
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo obtener el índice de precios del mes base", err)
+			return
+		}
+		args = append(args, baseIndex)
+		factor := fmt.Sprintf("$%d::numeric / (SELECT p.value FROM price_indexes p WHERE p.month = date_trunc('month', expenses.expense_date)::date)", len(args))
+		raw = "ROUND(amount * " + factor + ", 2)"
+		converted = "ROUND(" + convertedAmountSQL + " * " + factor + ", 2)"
+	default:
+		respondValidationError(c, "El parámetro 'adjust' acepta nominal o real", nil)
+		return
+	}
+
+	// El período va primero para que la serie temporal quede ordenada al graficar.
+	var columns, groups []string
+	if period != "" {
+		columns = append(columns, "date_trunc('"+period+"', expense_date)::date AS period")
+		groups = append(groups, "period")
+	}
+	if byTag {
+		columns = append(columns, "tag")
+		groups = append(groups, "tag")
+	}
+	if byCurrency {
+		columns = append(columns, "currency")
+		groups = append(groups, "currency")
+	}
+	// Solo los grupos de una misma moneda pueden sumar los montos originales;
+	// si no, el total y el promedio de cada grupo se calculan en la moneda base.
+	amount := converted
+	if byCurrency {
+		amount = raw
+	}
+	columns = append(columns, "COALESCE(SUM("+amount+"), 0)", "COUNT(*)", "COALESCE(ROUND(AVG("+amount+"), 2), 0)",
+		"COALESCE(SUM("+converted+"), 0)", "COUNT(*) - COUNT("+convertedAmountSQL+")", "COUNT("+converted+")")
+	if adjust == "real" {
+		columns = append(columns, "COUNT(*) - COUNT("+raw+")")
+	}
+
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM expenses WHERE " + where.clause()
+	if len(groups) > 0 {
+		query += " GROUP BY " + strings.Join(groups, ", ") + " ORDER BY " + strings.Join(groups, ", ")
+	}
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo calcular el resumen de gastos", err)
+		return
+	}
+	defer rows.Close()
+
+	summary := []models.SummaryGroup{}
+	var convertedTotal models.Money
+	var count, counted, unconverted, unadjusted int64
+	for rows.Next() {
+		var group models.SummaryGroup
+		var tag, currency sql.NullString
+		var periodStart time.Time
+		var groupCounted int64
+		dest := []interface{}{}
+		if period != "" {
+			dest = append(dest, &periodStart)
+		}
+		if byTag {
+			dest = append(dest, &tag)
+		}
+		if byCurrency {
+			dest = append(dest, &currency)
+		}
+		dest = append(dest, &group.Total, &group.Count, &group.Average, &group.ConvertedTotal, &group.Unconverted, &groupCounted)
+		if adjust == "real" {
+			dest = append(dest, &group.Unadjusted)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer el resumen de gastos", err)
+			return
+		}
+		if byTag {
+			group.Tag = &tag.String
+		}
+		if byCurrency {
+			group.Currency = &currency.String
+		}
+		if period != "" {
+			formatted := periodStart.Format("2006-01-02")
+			group.Period = &formatted
+		}
+		count += group.Count
+		counted += groupCounted
+		convertedTotal += group.ConvertedTotal
+		unconverted += group.Unconverted
+		unadjusted += group.Unadjusted
+		summary = append(summary, group)
+	}
+
+	// El total y el promedio generales siempre están en la moneda base, ya que
+	// los grupos pueden tener monedas distintas.
+	var average models.Money
+	if counted > 0 {
+		average = convertedTotal.Div(counted)
+	}
+
+	response := gin.H{
+		"groupBy":        groupBy,
+		"groups":         summary,
+		"total":          convertedTotal,
+		"count":          count,
+		"average":        average,
+		"convertedTotal": convertedTotal,
+		"unconverted":    unconverted,
+		"adjust":         adjust,
+	}
+	if adjust == "real" {
+		response["base"] = base.Format("2006-01")
+		response["unadjusted"] = unadjusted
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// maxCashFlowMonths limita el rango del flujo de caja.
+const maxCashFlowMonths = 120
+
+// CashFlow devuelve, para cada mes entre from y to (YYYY-MM, por defecto los
+// últimos 12 meses), los ingresos, los gastos y el resultado neto en la moneda
+// base del usuario. Los movimientos sin cotización se cuentan en "unconverted"
+// y no suman.
+func (h *Handler) CashFlow(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, -11, 0)
+	if toParam := c.Query("to"); toParam != "" {
+		month, err := parseMonth(toParam)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'to' debe usar el formato YYYY-MM", err)
+			return
+		}
+		to = month
+		from = to.AddDate(0, -11, 0)
+	}
+	if fromParam := c.Query("from"); fromParam != "" {
+		month, err := parseMonth(fromParam)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'from' debe usar el formato YYYY-MM", err)
+			return
+		}
+		from = month
+	}
+	if to.Before(from) {
+		respondValidationError(c, "El parámetro 'to' no puede ser anterior a 'from'", nil)
+		return
+	}
+	if months := (to.Year()-from.Year())*12 + int(to.Month()-from.Month()) + 1; months > maxCashFlowMonths {
+		respondValidationError(c, fmt.Sprintf("El rango no puede superar los %d meses", maxCashFlowMonths), nil)
+		return
+	}
+	end := to.AddDate(0, 1, 0)
+
+	rows, err := h.DB.Query(
+		`SELECT month, COALESCE(SUM(income), 0), COALESCE(SUM(expense), 0), COUNT(*) - COUNT(COALESCE(income, expense))
+		 FROM (
+			SELECT date_trunc('month', income_date)::date AS month, `+convertedAmountFor("incomes", "incomes.income_date")+` AS income, NULL::numeric AS expense
+			FROM incomes WHERE user_id=$1 AND income_date >= $2 AND income_date < $3
+			UNION ALL
+			SELECT date_trunc('month', expense_date)::date, NULL, `+convertedAmountSQL+`
+			FROM expenses WHERE user_id=$1 AND expense_date >= $2 AND expense_date < $3
+		 ) flows
+		 GROUP BY month
+		 ORDER BY month`,
+		userID, from.Format("2006-01-02"), end.Format("2006-01-02"),
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo calcular el flujo de caja", err)
+		return
+	}
+	defer rows.Close()
+
+	byMonth := map[string]models.CashFlowMonth{}
+	var unconverted int64
+	for rows.Next() {
+		var month time.Time
+		var flow models.CashFlowMonth
+		var missing int64
+		if err := rows.Scan(&month, &flow.Income, &flow.Expenses, &missing); err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer el flujo de caja", err)
+			return
+		}
+		byMonth[month.Format("2006-01")] = flow
+		unconverted += missing
+	}
+
+	// Los meses sin movimientos se devuelven en cero para que la serie sea continua.
+	months := []models.CashFlowMonth{}
+	var income, expenses models.Money
+	for month := from; month.Before(end); month = month.AddDate(0, 1, 0) {
+		flow := byMonth[month.Format("2006-01")]
+		flow.Month = month.Format("2006-01")
+		flow.Net = flow.Income - flow.Expenses
+		flow.SavingsRate = savingsRate(flow.Income, flow.Net)
+		income += flow.Income
+		expenses += flow.Expenses
+		months = append(months, flow)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"months":      months,
+		"income":      income,
+		"expenses":    expenses,
+		"net":         income - expenses,
+		"savingsRate": savingsRate(income, income-expenses),
+		"unconverted": unconverted,
+	})
+}
+
+// savingsRate devuelve net sobre income redondeado a 4 decimales, o nil si no
+// hubo ingresos.
+func savingsRate(income, net models.Money) *float64 {
+	if income <= 0 {
+		return nil
+	}
+	rate := math.Round(net.Float()/income.Float()*10000) / 10000
+	return &rate
+}
+
+// CategoryRollup devuelve el gasto de cada categoría del usuario, donde el
+// total de una categoría incluye el de todas sus descendientes. Acepta los
+// mismos filtros que la lista de gastos, y además level (profundidad en el
+// árbol, 0 para el primer nivel) o parentId para pedir solo un nivel.
+func (h *Handler) CategoryRollup(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var where whereBuilder
+	where.add("user_id=?", userID)
+	if !applyExpenseFilters(c, &where) {
+		return
+	}
+
+	args := where.args
+	var nodeFilter string
+	if levelParam := c.Query("level"); levelParam != "" {
+		level, err := strconv.Atoi(levelParam)
+		if err != nil || level < 0 {
+			respondValidationError(c, "El parámetro 'level' debe ser un entero mayor o igual a 0", err)
+			return
+		}
+		args = append(args, level)
+		nodeFilter += fmt.Sprintf(" AND levels.level = $%d", len(args))
+	}
+	if parentParam := c.Query("parentId"); parentParam != "" {
+		parentID, err := strconv.ParseInt(parentParam, 10, 64)
+		if err != nil {
+			respondValidationError(c, "El parámetro 'parentId' no es válido", err)
+			return
+		}
+		args = append(args, parentID)
+		nodeFilter += fmt.Sprintf(" AND c.parent_id = $%d", len(args))
+	}
+
+	// closure relaciona cada categoría consigo misma y con todas sus
+	// descendientes; levels calcula la profundidad desde las de primer nivel.
+	rows, err := h.DB.Query(
+		`WITH RECURSIVE closure AS (
+			SELECT id AS ancestor_id, id AS descendant_id FROM categories WHERE user_id=$1
+			UNION
+			SELECT closure.ancestor_id, child.id
+			FROM closure JOIN categories child ON child.parent_id = closure.descendant_id
+		 ),
+		 levels AS (
+			SELECT id, 0 AS level FROM categories WHERE user_id=$1 AND parent_id IS NULL
+			UNION ALL
+			SELECT child.id, levels.level + 1
+			FROM levels JOIN categories child ON child.parent_id = levels.id
+		 ),
+		 spent AS (
+			SELECT tag, SUM(converted) AS total, COUNT(*) AS expenses, COUNT(*) - COUNT(converted) AS unconverted
+			FROM (SELECT tag, `+convertedAmountSQL+` AS converted FROM expenses WHERE `+where.clause()+`) e
+			GROUP BY tag
+		 )
+		 SELECT c.id, c.user_id, c.name, c.color, c.icon, c.parent_id, c.created_at, levels.level,
+			COALESCE(SUM(s.total) FILTER (WHERE d.id = c.id), 0),
+			COALESCE(SUM(s.total), 0),
+			COALESCE(SUM(s.expenses), 0),
+			COALESCE(SUM(s.unconverted), 0)
+		 FROM categories c
+		 JOIN levels ON levels.id = c.id
+		 JOIN closure ON closure.ancestor_id = c.id
+		 JOIN categories d ON d.id = closure.descendant_id
+		 LEFT JOIN spent s ON s.tag = d.name
+		 WHERE c.user_id=$1`+nodeFilter+`
+		 GROUP BY c.id, levels.level
+		 ORDER BY levels.level, lower(c.name)`,
+		args...,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "No se pudo calcular el gasto por categoría", err)
+		return
+	}
+	defer rows.Close()
+
+	totals := []models.CategoryTotal{}
+	for rows.Next() {
+		var total models.CategoryTotal
+		category, err := scanCategory(rows, &total.Level, &total.Own, &total.Total, &total.Expenses, &total.Unconverted)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "No se pudo leer el gasto por categoría", err)
+			return
+		}
+		total.Category = category
+		totals = append(totals, total)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": totals})
+}
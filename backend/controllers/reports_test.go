@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpendingSummary_ByTagAndMonth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/summary", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.SpendingSummary(c)
+	})
+
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT date_trunc\('month', expense_date\)::date AS period, tag, .* FROM expenses WHERE user_id=\$1 AND expense_date >= \$2 GROUP BY period, tag ORDER BY period, tag`).
+		WithArgs(int64(1), "2024-03-01").
+		WillReturnRows(sqlmock.NewRows([]string{"period", "tag", "sum", "count", "avg", "converted", "unconverted", "counted"}).
+			AddRow(march, "Food", 150.0, 3, 50.0, 150.0, 0, 3).
+			AddRow(march, "Transport", 50.0, 1, 50.0, 50.0, 0, 1))
+
+	req, _ := http.NewRequest("GET", "/reports/summary?groupBy=tag,month&from=2024-03-01", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"period":"2024-03-01"`)
+	assert.Contains(t, w.Body.String(), `"tag":"Transport"`)
+	assert.Contains(t, w.Body.String(), `"total":200`)
+	assert.Contains(t, w.Body.String(), `"count":4`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSpendingSummary_WithoutGrouping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/summary", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.SpendingSummary(c)
+	})
+
+	mock.ExpectQuery(`SELECT COALESCE\(SUM\(\(SELECT CASE WHEN expenses.currency = u.base_currency .*\), 0\), COUNT\(\*\), .* FROM expenses WHERE user_id=\$1$`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"sum", "count", "avg", "converted", "unconverted", "counted"}).AddRow(0, 0, 0, 0, 0, 0))
+
+	req, _ := http.NewRequest("GET", "/reports/summary", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"average":0`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSpendingSummary_InvalidGroupBy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/summary", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.SpendingSummary(c)
+	})
+
+	for _, groupBy := range []string{"year", "month,week", "tag,tag"} {
+		req, _ := http.NewRequest("GET", "/reports/summary?groupBy="+groupBy, nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, groupBy)
+		assert.Contains(t, w.Body.String(), "El parámetro 'groupBy'")
+	}
+}
+
+func TestSpendingSummary_DBError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/summary", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.SpendingSummary(c)
+	})
+
+	mock.ExpectQuery("FROM expenses").
+		WithArgs(int64(1)).
+		WillReturnError(sql.ErrConnDone)
+
+	req, _ := http.NewRequest("GET", "/reports/summary?groupBy=tag", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "No se pudo calcular el resumen de gastos")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSpendingSummary_ByCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/summary", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.SpendingSummary(c)
+	})
+
+	mock.ExpectQuery(`SELECT currency, .* FROM expenses WHERE user_id=\$1 GROUP BY currency ORDER BY currency`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "sum", "count", "avg", "converted", "unconverted", "counted"}).
+			AddRow("ARS", "5000.00", 2, "2500.00", "5000.00", 0, 2).
+			AddRow("USD", "30.00", 2, "15.00", "10500.00", 1, 1))
+
+	req, _ := http.NewRequest("GET", "/reports/summary?groupBy=currency", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"currency":"USD"`)
+	assert.Contains(t, w.Body.String(), `"convertedTotal":15500.00`)
+	assert.Contains(t, w.Body.String(), `"unconverted":1`)
+	// The overall figures add up the converted amounts, never ARS and USD together.
+	assert.Contains(t, w.Body.String(), `"total":15500.00`)
+	assert.Contains(t, w.Body.String(), `"average":5166.67`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSpendingSummary_AdjustedToRealTerms(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/summary", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.SpendingSummary(c)
+	})
+
+	mock.ExpectQuery(`SELECT value FROM price_indexes WHERE month=\$1`).
+		WithArgs("2025-01-01").
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("7864.1257"))
+	mock.ExpectQuery(`SUM\(ROUND\(\(SELECT CASE .* \* \$2::numeric / \(SELECT p.value FROM price_indexes p .* COUNT\(\*\) - COUNT\(ROUND\(amount \* \$2::numeric .* GROUP BY period ORDER BY period`).
+		WithArgs(int64(1), "7864.1257").
+		WillReturnRows(sqlmock.NewRows([]string{"period", "sum", "count", "avg", "converted", "unconverted", "counted", "unadjusted"}).
+			AddRow(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), "90000.00", 2, "45000.00", "90000.00", 0, 2, 0).
+			AddRow(time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), "30000.00", 2, "30000.00", "30000.00", 0, 1, 1))
+
+	req, _ := http.NewRequest("GET", "/reports/summary?groupBy=month&adjust=real&base=2025-01", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"base":"2025-01"`)
+	assert.Contains(t, w.Body.String(), `"total":120000.00`)
+	assert.Contains(t, w.Body.String(), `"unadjusted":1`)
+	assert.Contains(t, w.Body.String(), `"average":40000.00`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSpendingSummary_AdjustedWithoutBaseIndex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/summary", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.SpendingSummary(c)
+	})
+
+	mock.ExpectQuery(`SELECT value FROM price_indexes WHERE month=\$1`).
+		WithArgs("2030-01-01").
+		WillReturnError(sql.ErrNoRows)
+
+	req, _ := http.NewRequest("GET", "/reports/summary?adjust=real&base=2030-01", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "mes base 2030-01")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCashFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/cash-flow", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CashFlow(c)
+	})
+
+	mock.ExpectQuery(`FROM incomes WHERE user_id=\$1 AND income_date >= \$2 AND income_date < \$3\s+UNION ALL`).
+		WithArgs(int64(1), "2024-01-01", "2024-04-01").
+		WillReturnRows(sqlmock.NewRows([]string{"month", "income", "expense", "unconverted"}).
+			AddRow(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "1000.00", "750.00", 0).
+			AddRow(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "0", "200.00", 1))
+
+	req, _ := http.NewRequest("GET", "/reports/cash-flow?from=2024-01&to=2024-03", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `{"month":"2024-01","income":1000.00,"expenses":750.00,"net":250.00,"savingsRate":0.25}`)
+	assert.Contains(t, w.Body.String(), `{"month":"2024-02","income":0.00,"expenses":0.00,"net":0.00}`)
+	assert.Contains(t, w.Body.String(), `{"month":"2024-03","income":0.00,"expenses":200.00,"net":-200.00}`)
+	assert.Contains(t, w.Body.String(), `"net":50.00,"savingsRate":0.05,"unconverted":1`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCashFlow_InvalidRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/cash-flow", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CashFlow(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/reports/cash-flow?from=2024-05&to=2024-03", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCategoryRollup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/categories", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CategoryRollup(c)
+	})
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`WITH RECURSIVE closure AS .* FROM expenses WHERE user_id=\$1 AND expense_date >= \$2\) e .* WHERE c.user_id=\$1 AND c.parent_id = \$3\s+GROUP BY c.id, levels.level`).
+		WithArgs(int64(1), "2024-03-01", int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "color", "icon", "parent_id", "created_at",
+			"level", "own", "total", "expenses", "unconverted"}).
+			AddRow(3, 1, "Servicios", "", "", 2, createdAt, 1, "0", "45000.00", 3, 0).
+			AddRow(5, 1, "Supermercado", "", "", 2, createdAt, 1, "120000.50", "120000.50", 4, 1))
+
+	req, _ := http.NewRequest("GET", "/reports/categories?from=2024-03-01&parentId=2", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(),
+		`"name":"Servicios","color":"","icon":"","parentId":2,"createdAt":"2024-01-01T00:00:00Z","level":1,"own":0.00,"total":45000.00,"expenses":3`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCategoryRollup_InvalidLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewHandler(db, "secret")
+	router := gin.Default()
+	router.GET("/reports/categories", func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		handler.CategoryRollup(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/reports/categories?level=-1", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
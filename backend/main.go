@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 
 	"gestor-gastos/config"
@@ -8,6 +10,7 @@ import (
 	"gestor-gastos/database"
 	"gestor-gastos/models"
 	"gestor-gastos/routes"
+	"gestor-gastos/scheduler"
 )
 
 func main() {
@@ -30,6 +33,24 @@ func main() {
 	}
 
 	handler := controllers.NewHandler(db, cfg.JWTSecret)
+
+	if cfg.SchedulerInterval > 0 {
+		go scheduler.Run(context.Background(), db, cfg.SchedulerInterval, scheduler.RecurringExpensesLockKey, "recurring-expenses",
+			func(ctx context.Context) error {
+				// The income run does not depend on the expense run, so a
+				// failing expense template must not hold incomes back.
+				applied, expensesErr := handler.ApplyDueMonthlyExpenses(ctx)
+				if applied > 0 {
+					log.Printf("scheduler: applied %d recurring expenses", applied)
+				}
+				applied, incomesErr := handler.ApplyDueMonthlyIncomes(ctx)
+				if applied > 0 {
+					log.Printf("scheduler: applied %d recurring incomes", applied)
+				}
+				return errors.Join(expensesErr, incomesErr)
+			})
+	}
+
 	router := routes.Setup(cfg, handler)
 
 	if err := router.Run(":" + cfg.APIPort); err != nil {
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Installment is one generated payment of an installment plan.
+type Installment struct {
+	Number int
+	Date   time.Time
+	Amount Money
+}
+
+// InstallmentLabel is the suffix shown on each generated expense, e.g. "cuota 4/12".
+func InstallmentLabel(number, count int) string {
+	return fmt.Sprintf("cuota %d/%d", number, count)
+}
+
+// Interest is the amount InterestRate adds to Total, rounded to the cent. The
+// rate is scaled to the four decimals the column stores so the calculation
+// stays in whole cents.
+func (p InstallmentPlan) Interest() Money {
+	rate := Money(math.Round(p.InterestRate * 10000))
+	return (p.Total * rate).Div(1000000)
+}
+
+// Schedule splits the plan total, plus its interest, into one installment per
+// month starting at firstDue. The leftover cents go to the first
+// installments, so they always add up to the financed total. Days past the end
+// of a month are clamped to its last day.
+func (p InstallmentPlan) Schedule(firstDue time.Time) []Installment {
+	if p.Installments <= 0 {
+		return nil
+	}
+	financed := p.Total + p.Interest()
+	base := financed / Money(p.Installments)
+	extra := financed % Money(p.Installments)
+
+	first := Date(firstDue)
+	schedule := make([]Installment, 0, p.Installments)
+	for i := 0; i < p.Installments; i++ {
+		amount := base
+		if Money(i) < extra {
+			amount++
+		}
+		monthStart := time.Date(first.Year(), first.Month()+time.Month(i), 1, 0, 0, 0, 0, time.UTC)
+		lastDay := time.Date(monthStart.Year(), monthStart.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		day := first.Day()
+		if day > lastDay {
+			day = lastDay
+		}
+		schedule = append(schedule, Installment{
+			Number: i + 1,
+			Date:   time.Date(monthStart.Year(), monthStart.Month(), day, 0, 0, 0, 0, time.UTC),
+			Amount: amount,
+		})
+	}
+	return schedule
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule_SplitsCentsAndClampsDays(t *testing.T) {
+	plan := InstallmentPlan{Total: 10000, Installments: 3}
+
+	schedule := plan.Schedule(day(2024, 1, 31))
+
+	assert.Len(t, schedule, 3)
+	assert.Equal(t, []time.Time{day(2024, 1, 31), day(2024, 2, 29), day(2024, 3, 31)},
+		[]time.Time{schedule[0].Date, schedule[1].Date, schedule[2].Date})
+	assert.Equal(t, []Money{3334, 3333, 3333},
+		[]Money{schedule[0].Amount, schedule[1].Amount, schedule[2].Amount})
+	assert.Equal(t, 3, schedule[2].Number)
+}
+
+func TestSchedule_AddsInterest(t *testing.T) {
+	plan := InstallmentPlan{Total: 120000, Installments: 12, InterestRate: 10}
+
+	schedule := plan.Schedule(day(2024, 5, 10))
+
+	assert.Len(t, schedule, 12)
+	assert.Equal(t, Money(11000), schedule[0].Amount)
+	assert.Equal(t, day(2025, 4, 10), schedule[11].Date)
+}
+
+func TestInterest_RoundsInCents(t *testing.T) {
+	// 1.16 at 12.5% is 0.145 exactly, which float arithmetic rounds down.
+	plan := InstallmentPlan{Total: 116, Installments: 1, InterestRate: 12.5}
+
+	assert.Equal(t, Money(15), plan.Interest())
+	assert.Equal(t, Money(131), plan.Schedule(day(2024, 1, 1))[0].Amount)
+}
+
+func TestInstallmentLabel(t *testing.T) {
+	assert.Equal(t, "cuota 4/12", InstallmentLabel(4, 12))
+}
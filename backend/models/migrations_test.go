@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordMigrations runs the migrations against a mock that accepts every
+// statement and returns them in execution order. Statements that start with
+// failing, if it is not empty, fail instead and are not recorded.
+func recordMigrations(t *testing.T, failing string) []string {
+	var executed []string
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(
+		func(_, actual string) error {
+			if failing != "" && strings.HasPrefix(strings.TrimSpace(actual), failing) {
+				return errors.New("permission denied")
+			}
+			executed = append(executed, actual)
+			return nil
+		},
+	)))
+	require.NoError(t, err)
+	defer db.Close()
+	for i := 0; i < 500; i++ {
+		mock.ExpectExec("").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	require.NoError(t, RunMigrations(db))
+	return executed
+}
+
+func indexOf(statements []string, prefix string) int {
+	for i, stmt := range statements {
+		if strings.HasPrefix(strings.TrimSpace(stmt), prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRunMigrations_DeletesBudgetVariantsBeforeRenaming(t *testing.T) {
+	executed := recordMigrations(t, "")
+
+	dedupe := indexOf(executed, "DELETE FROM budgets b")
+	rename := indexOf(executed, "UPDATE budgets b SET tag = c.name")
+	require.NotEqual(t, -1, dedupe)
+	require.NotEqual(t, -1, rename)
+	assert.Less(t, dedupe, rename)
+
+	// Every variant is renamed; none is left with a tag outside categories.
+	assert.NotContains(t, executed[rename], "NOT EXISTS")
+}
+
+func TestRunMigrations_CreatesTrigramIndex(t *testing.T) {
+	executed := recordMigrations(t, "")
+
+	extension := indexOf(executed, "CREATE EXTENSION IF NOT EXISTS pg_trgm")
+	index := indexOf(executed, "CREATE INDEX IF NOT EXISTS idx_expenses_name_trgm")
+	require.NotEqual(t, -1, extension)
+	assert.Less(t, extension, index)
+}
+
+// Without the privilege to create pg_trgm the migrations still succeed; only
+// the trigram index is skipped.
+func TestRunMigrations_SkipsTrigramIndexWithoutExtension(t *testing.T) {
+	executed := recordMigrations(t, "CREATE EXTENSION")
+
+	assert.Equal(t, -1, indexOf(executed, "CREATE INDEX IF NOT EXISTS idx_expenses_name_trgm"))
+	assert.NotEqual(t, -1, indexOf(executed, "CREATE TABLE IF NOT EXISTS budgets"))
+}
+
+// TestRunMigrations_MergesCollidingBudgets needs a Postgres database in
+// TEST_DATABASE_URL. It runs in its own schema, which is dropped afterwards.
+func TestRunMigrations_MergesCollidingBudgets(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	require.NoError(t, err)
+	defer db.Close()
+	// A single connection keeps the search_path for every statement.
+	db.SetMaxOpenConns(1)
+
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	_, err = db.Exec(`CREATE SCHEMA ` + schema + `; SET search_path TO ` + schema + `, public`)
+	require.NoError(t, err)
+	defer db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+
+	require.NoError(t, RunMigrations(db))
+
+	var userID int64
+	require.NoError(t, db.QueryRow(
+		`INSERT INTO users (name, email, password_hash) VALUES ('Ana', 'ana@example.com', 'x') RETURNING id`,
+	).Scan(&userID))
+	_, err = db.Exec(
+		`INSERT INTO budgets (user_id, tag, monthly_limit, created_at) VALUES
+			($1, 'Comida', 100, now() - interval '1 day'),
+			($1, 'comida ', 250, now())`,
+		userID,
+	)
+	require.NoError(t, err)
+
+	// Running the migrations again normalises the tags without violating
+	// UNIQUE (user_id, tag).
+	require.NoError(t, RunMigrations(db))
+
+	var category string
+	require.NoError(t, db.QueryRow(`SELECT name FROM categories WHERE user_id=$1`, userID).Scan(&category))
+	var tag string
+	var limit Money
+	var count int
+	require.NoError(t, db.QueryRow(
+		`SELECT tag, monthly_limit, COUNT(*) OVER () FROM budgets WHERE user_id=$1`, userID,
+	).Scan(&tag, &limit, &count))
+	assert.Equal(t, 1, count)
+	assert.Equal(t, category, tag)
+	// The newest budget is the one kept.
+	assert.Equal(t, Money(25000), limit)
+}
@@ -3,19 +3,32 @@ package models
 import "time"
 
 type User struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// BaseCurrency is the ISO 4217 code amounts are converted to in reports.
+	BaseCurrency string    `json:"baseCurrency"`
+	CreatedAt    time.Time `json:"createdAt"`
 }
 
 type Expense struct {
-	ID     int64   `json:"id"`
-	UserID int64   `json:"-"`
-	Name   string  `json:"name"`
-	Tag    string  `json:"tag"`
-	Amount float64 `json:"amount"`
-	Date   string  `json:"date"`
+	ID     int64  `json:"id"`
+	UserID int64  `json:"-"`
+	Name   string `json:"name"`
+	Tag    string `json:"tag"`
+	Amount Money  `json:"amount"`
+	Date   string `json:"date"`
+	// Currency is the ISO 4217 code of Amount.
+	Currency string `json:"currency"`
+	// AccountID is the account the expense was paid from.
+	AccountID *int64 `json:"accountId,omitempty"`
+	// InstallmentPlanID and InstallmentNumber are set on expenses generated
+	// by an installment plan.
+	InstallmentPlanID *int64 `json:"installmentPlanId,omitempty"`
+	InstallmentNumber *int   `json:"installmentNumber,omitempty"`
+	// ConvertedAmount is Amount in the user's base currency using the rate
+	// valid on Date. It is nil when no rate is stored for that date.
+	ConvertedAmount *Money `json:"convertedAmount,omitempty"`
 }
 
 type MonthlyExpense struct {
@@ -23,7 +36,303 @@ type MonthlyExpense struct {
 	UserID        int64      `json:"-"`
 	Name          string     `json:"name"`
 	Tag           string     `json:"tag"`
-	Amount        float64    `json:"amount"`
+	Amount        Money      `json:"amount"`
+	Currency      string     `json:"currency"`
+	AccountID     *int64     `json:"accountId,omitempty"`
 	LastAppliedAt *time.Time `json:"lastAppliedAt,omitempty"`
 	LastExpenseID *int64     `json:"lastExpenseId,omitempty"`
+	AutoApply     bool       `json:"autoApply"`
+	Frequency     Frequency  `json:"frequency"`
+	DayOfMonth    *int       `json:"dayOfMonth,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	// StartsOn and EndsOn bound the dates the template is due on; both are
+	// inclusive and optional.
+	StartsOn       *time.Time `json:"startsOn,omitempty"`
+	EndsOn         *time.Time `json:"endsOn,omitempty"`
+	Paused         bool       `json:"paused"`
+	MaxOccurrences *int       `json:"maxOccurrences,omitempty"`
+	// Occurrences counts the applications recorded for the template.
+	Occurrences int `json:"occurrences"`
+	// Due reports whether the template can be applied in the current period.
+	Due bool `json:"due"`
+}
+
+// MonthlyExpenseApplication links a recurring template to one expense it generated.
+type MonthlyExpenseApplication struct {
+	ID               int64     `json:"id"`
+	MonthlyExpenseID int64     `json:"monthlyExpenseId"`
+	AppliedAt        time.Time `json:"appliedAt"`
+	Expense          Expense   `json:"expense"`
+}
+
+// InstallmentPlan is a purchase paid in monthly installments ("cuotas"). Each
+// installment is stored as an expense linked to the plan.
+type InstallmentPlan struct {
+	ID           int64  `json:"id"`
+	UserID       int64  `json:"-"`
+	Name         string `json:"name"`
+	Tag          string `json:"tag"`
+	Total        Money  `json:"total"`
+	Installments int    `json:"installments"`
+	FirstDueDate string `json:"firstDueDate"`
+	// InterestRate is the percentage added to Total over the whole plan.
+	InterestRate float64 `json:"interestRate"`
+	// AccountID is the account (usually a credit card) the installments are charged to.
+	AccountID   *int64     `json:"accountId,omitempty"`
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+type Budget struct {
+	ID         int64   `json:"id"`
+	UserID     int64   `json:"-"`
+	Tag        string  `json:"tag"`
+	Limit      Money   `json:"limit"`
+	StartMonth *string `json:"startMonth,omitempty"`
+	Rollover   bool    `json:"rollover"`
+}
+
+// BudgetStatus compares a budget limit with what was spent in a given month.
+// Limit and Spent are in the user's base currency; Unconverted counts the
+// expenses left out of Spent for lack of an exchange rate.
+type BudgetStatus struct {
+	BudgetID    int64   `json:"budgetId"`
+	Tag         string  `json:"tag"`
+	Limit       Money   `json:"limit"`
+	Spent       Money   `json:"spent"`
+	Remaining   Money   `json:"remaining"`
+	Percentage  float64 `json:"percentage"`
+	Unconverted int64   `json:"unconverted"`
+}
+
+// EnvelopeMonth is one month of an envelope ledger. Available is what is left
+// after spending, and becomes the next month's carry-over when rollover is on.
+// Amounts are in the user's base currency, as in BudgetStatus.
+type EnvelopeMonth struct {
+	Month       string `json:"month"`
+	Limit       Money  `json:"limit"`
+	CarryOver   Money  `json:"carryOver"`
+	Spent       Money  `json:"spent"`
+	Available   Money  `json:"available"`
+	Unconverted int64  `json:"unconverted"`
+}
+
+type Envelope struct {
+	BudgetID int64           `json:"budgetId"`
+	Tag      string          `json:"tag"`
+	Rollover bool            `json:"rollover"`
+	Months   []EnvelopeMonth `json:"months"`
+}
+
+// SummaryGroup is one row of an aggregated spending report. Tag, Currency and
+// Period are only present when the report is grouped by them. Total and
+// Average are in the group's currency when grouped by currency, and in the
+// user's base currency otherwise.
+type SummaryGroup struct {
+	Tag      *string `json:"tag,omitempty"`
+	Currency *string `json:"currency,omitempty"`
+	Period   *string `json:"period,omitempty"`
+	Total    Money   `json:"total"`
+	Count    int64   `json:"count"`
+	Average  Money   `json:"average"`
+	// ConvertedTotal adds the amounts converted to the base currency;
+	// Unconverted counts the expenses left out for lack of a rate.
+	ConvertedTotal Money `json:"convertedTotal"`
+	Unconverted    int64 `json:"unconverted"`
+	// Unadjusted counts the expenses left out of an inflation-adjusted report
+	// because their month has no price index.
+	Unadjusted int64 `json:"unadjusted,omitempty"`
+}
+
+// SkippedMonthlyExpense is a recurring template that was not applied, with the
+// reason shown to the user.
+type SkippedMonthlyExpense struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ForecastTag is the projected outflow of one tag within a forecast month.
+// Recurring comes from recurring templates, Scheduled from expenses already
+// recorded with a future date (such as installments) and Estimated from the
+// tag's historical monthly average.
+type ForecastTag struct {
+	Tag       string `json:"tag"`
+	Recurring Money  `json:"recurring"`
+	Scheduled Money  `json:"scheduled"`
+	Estimated Money  `json:"estimated"`
+	Total     Money  `json:"total"`
+}
+
+// ForecastMonth is the projected outflow of one month ("YYYY-MM").
+type ForecastMonth struct {
+	Month     string        `json:"month"`
+	Recurring Money         `json:"recurring"`
+	Scheduled Money         `json:"scheduled"`
+	Estimated Money         `json:"estimated"`
+	Total     Money         `json:"total"`
+	Tags      []ForecastTag `json:"tags"`
+}
+
+// ExchangeRate is how many units of BaseCurrency one unit of Currency is worth
+// from ValidOn until the next rate for the same pair.
+type ExchangeRate struct {
+	ID           int64   `json:"id"`
+	Currency     string  `json:"currency"`
+	BaseCurrency string  `json:"baseCurrency"`
+	Rate         float64 `json:"rate"`
+	ValidOn      string  `json:"validOn"`
+}
+
+// PriceIndex is the consumer price index of a month ("YYYY-MM"), used to
+// restate amounts in constant money of another month.
+type PriceIndex struct {
+	ID    int64   `json:"id"`
+	Month string  `json:"month"`
+	Value float64 `json:"value"`
+}
+
+type Income struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"-"`
+	Source   string `json:"source"`
+	Tag      string `json:"tag"`
+	Amount   Money  `json:"amount"`
+	Date     string `json:"date"`
+	Currency string `json:"currency"`
+	// AccountID is the account the income was credited to.
+	AccountID *int64 `json:"accountId,omitempty"`
+	// MonthlyIncomeID is the recurring template the income was generated from.
+	MonthlyIncomeID *int64 `json:"monthlyIncomeId,omitempty"`
+}
+
+// MonthlyIncome is a recurring income template. Its schedule works like the
+// one of MonthlyExpense.
+type MonthlyIncome struct {
+	ID            int64      `json:"id"`
+	UserID        int64      `json:"-"`
+	Source        string     `json:"source"`
+	Tag           string     `json:"tag"`
+	Amount        Money      `json:"amount"`
+	Currency      string     `json:"currency"`
+	AccountID     *int64     `json:"accountId,omitempty"`
+	LastAppliedAt *time.Time `json:"lastAppliedAt,omitempty"`
+	LastIncomeID  *int64     `json:"lastIncomeId,omitempty"`
+	AutoApply     bool       `json:"autoApply"`
+	Frequency     Frequency  `json:"frequency"`
+	DayOfMonth    *int       `json:"dayOfMonth,omitempty"`
+	StartsOn      *time.Time `json:"startsOn,omitempty"`
+	EndsOn        *time.Time `json:"endsOn,omitempty"`
+	Paused        bool       `json:"paused"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	// MaxOccurrences and Occurrences work like the ones of MonthlyExpense.
+	MaxOccurrences *int `json:"maxOccurrences,omitempty"`
+	Occurrences    int  `json:"occurrences"`
+	// Due reports whether the template can be applied in the current period.
+	Due bool `json:"due"`
+}
+
+// CashFlowMonth is the income, spending and net result of one month
+// ("YYYY-MM") in the user's base currency. SavingsRate is Net over Income and
+// is omitted when there was no income.
+type CashFlowMonth struct {
+	Month       string   `json:"month"`
+	Income      Money    `json:"income"`
+	Expenses    Money    `json:"expenses"`
+	Net         Money    `json:"net"`
+	SavingsRate *float64 `json:"savingsRate,omitempty"`
+}
+
+// AccountType is the kind of place money is kept in.
+type AccountType string
+
+const (
+	AccountCash       AccountType = "cash"
+	AccountBank       AccountType = "bank"
+	AccountCreditCard AccountType = "credit_card"
+	AccountWallet     AccountType = "wallet"
+)
+
+// Valid reports whether t is one of the supported account types.
+func (t AccountType) Valid() bool {
+	switch t {
+	case AccountCash, AccountBank, AccountCreditCard, AccountWallet:
+		return true
+	}
+	return false
+}
+
+type Account struct {
+	ID             int64       `json:"id"`
+	UserID         int64       `json:"-"`
+	Name           string      `json:"name"`
+	Type           AccountType `json:"type"`
+	Currency       string      `json:"currency"`
+	OpeningBalance Money       `json:"openingBalance"`
+	// ClosingDay and DueDay define the statement cycle of credit cards.
+	ClosingDay *int      `json:"closingDay,omitempty"`
+	DueDay     *int      `json:"dueDay,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Transfer moves money between two accounts of the same user. ToAmount is what
+// reaches the destination, which differs from Amount when the accounts use
+// different currencies.
+type Transfer struct {
+	ID            int64  `json:"id"`
+	FromAccountID int64  `json:"fromAccountId"`
+	ToAccountID   int64  `json:"toAccountId"`
+	Amount        Money  `json:"amount"`
+	ToAmount      Money  `json:"toAmount"`
+	Date          string `json:"date"`
+	Note          string `json:"note"`
+}
+
+// AccountBalance is the current balance of an account: the opening balance
+// plus incomes and incoming transfers, minus expenses and outgoing transfers
+// dated today or earlier. Movements recorded in another currency are left out
+// and counted in Excluded.
+type AccountBalance struct {
+	Account
+	Incomes      Money `json:"incomes"`
+	Expenses     Money `json:"expenses"`
+	TransfersIn  Money `json:"transfersIn"`
+	TransfersOut Money `json:"transfersOut"`
+	Balance      Money `json:"balance"`
+	Excluded     int64 `json:"excluded"`
+}
+
+// Category is an expense tag. Names are unique per user ignoring case and
+// repeated spaces; expenses, templates, installment plans and budgets store the
+// category name in their tag column.
+type Category struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"-"`
+	Name   string `json:"name"`
+	Color  string `json:"color"`
+	Icon   string `json:"icon"`
+	// ParentID places the category under another one, e.g. Luz under Servicios.
+	ParentID  *int64    `json:"parentId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CategoryTotal is the spending of a category in a period. Own counts only the
+// expenses tagged with the category itself, while Total and Expenses also
+// include every descendant. Level is the depth in the tree, 0 for top-level
+// categories.
+type CategoryTotal struct {
+	Category
+	Level       int   `json:"level"`
+	Own         Money `json:"own"`
+	Total       Money `json:"total"`
+	Expenses    int64 `json:"expenses"`
+	Unconverted int64 `json:"unconverted"`
+}
+
+// RuleMatchCount is how many uncategorised expenses a rule tags, or would tag,
+// when the rules are re-run.
+type RuleMatchCount struct {
+	RuleID   int64  `json:"ruleId"`
+	Tag      string `json:"tag"`
+	Expenses int64  `json:"expenses"`
 }
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount stored as a whole number of cents, so sums are exact. It
+// maps to NUMERIC(12,2) columns and is serialised as a JSON number with
+// exactly two decimals, e.g. 1000.50.
+type Money int64
+
+// ErrMoneyPrecision is returned when an amount has more than two decimals.
+var ErrMoneyPrecision = errors.New("money: amounts can have at most two decimals")
+
+// ErrMoneyRange is returned when an amount does not fit in the columns that
+// store it.
+var ErrMoneyRange = errors.New("money: amounts can have at most 10 integer digits")
+
+// maxMoneyDigits keeps parsed amounts far from overflowing int64. It is
+// larger than the storage limit because sums of stored amounts are scanned
+// with ParseMoney too.
+const maxMoneyDigits = 16
+
+// MaxStoredMoney is the largest amount a NUMERIC(12,2) column holds: 10
+// integer digits and 2 decimals.
+const MaxStoredMoney = Money(999999999999)
+
+// ParseMoney parses a decimal such as "12", "-3.5" or "1000.25". Trailing
+// zeros past the second decimal are accepted; any other digit is rejected.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(whole) > maxMoneyDigits || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("money: invalid amount %q", s)
+	}
+	if len(frac) > 2 {
+		if strings.Trim(frac[2:], "0") != "" {
+			return 0, ErrMoneyPrecision
+		}
+		frac = frac[:2]
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	cents, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("money: invalid amount %q: %w", s, err)
+	}
+	if negative {
+		cents = -cents
+	}
+	return Money(cents), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MoneyFromFloat rounds f to the nearest cent.
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * 100))
+}
+
+// Float returns the amount in currency units. Use it only for ratios, never
+// to add amounts.
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// Div splits the amount in n parts, rounding half away from zero to the cent.
+func (m Money) Div(n int64) Money {
+	q, r := m/Money(n), m%Money(n)
+	if r < 0 {
+		r = -r
+	}
+	if 2*int64(r) >= absInt64(n) {
+		if (m < 0) != (n < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+func absInt64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts both a number and a numeric string that fits in
+// NUMERIC(12,2).
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	parsed, err := ParseMoney(strings.Trim(text, `"`))
+	if err != nil {
+		return err
+	}
+	// Requests are rejected here rather than by a numeric overflow in Postgres.
+	if parsed > MaxStoredMoney || parsed < -MaxStoredMoney {
+		return ErrMoneyRange
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a NUMERIC column, which the driver returns as text.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		parsed, err := ParseMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = MoneyFromFloat(v)
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	return nil
+}
+
+// Value writes the amount as a decimal string so NUMERIC stores it exactly.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
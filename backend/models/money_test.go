@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := map[string]Money{
+		"12":       1200,
+		"0.1":      10,
+		"1000.25":  100025,
+		"-3.5":     -350,
+		"4.500":    450,
+		" 7.05 ":   705,
+		"+2":       200,
+		"00000.01": 1,
+	}
+	for input, want := range cases {
+		got, err := ParseMoney(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	_, err := ParseMoney("1.005")
+	assert.ErrorIs(t, err, ErrMoneyPrecision)
+	for _, input := range []string{"", "abc", "1.2.3", ".5", "1e3", "-"} {
+		_, err := ParseMoney(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var payload struct {
+		A Money  `json:"a"`
+		B Money  `json:"b"`
+		C *Money `json:"c"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"a": 0.1, "b": "0.2", "c": null}`), &payload))
+	assert.Equal(t, Money(30), payload.A+payload.B)
+	assert.Nil(t, payload.C)
+
+	out, err := json.Marshal(map[string]Money{"sum": payload.A + payload.B, "neg": -5})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"sum": 0.30, "neg": -0.05}`, string(out))
+	assert.Contains(t, string(out), `"sum":0.30`)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"a": 1.999}`), &payload))
+}
+
+func TestMoneyJSON_RejectsAmountsOutsideTheColumn(t *testing.T) {
+	var m Money
+	assert.NoError(t, json.Unmarshal([]byte(`9999999999.99`), &m))
+	assert.Equal(t, MaxStoredMoney, m)
+
+	// 11 integer digits overflow NUMERIC(12,2).
+	assert.ErrorIs(t, json.Unmarshal([]byte(`10000000000`), &m), ErrMoneyRange)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`"-10000000000.00"`), &m), ErrMoneyRange)
+
+	// Sums read from the database may be larger than a single amount.
+	assert.NoError(t, m.Scan([]byte("12345678901234.50")))
+}
+
+func TestMoneyScanAndValue(t *testing.T) {
+	var m Money
+	assert.NoError(t, m.Scan([]byte("1234.50")))
+	assert.Equal(t, Money(123450), m)
+	assert.NoError(t, m.Scan(19.99))
+	assert.Equal(t, Money(1999), m)
+	assert.Error(t, m.Scan(nil))
+
+	value, err := Money(-1050).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "-10.50", value)
+}
+
+func TestMoneyDiv(t *testing.T) {
+	assert.Equal(t, Money(3333), Money(10000).Div(3))
+	assert.Equal(t, Money(6667), Money(20000).Div(3))
+	assert.Equal(t, Money(-6667), Money(-20000).Div(3))
+	assert.Equal(t, Money(50), Money(100).Div(2))
+}
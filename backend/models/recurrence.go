@@ -0,0 +1,235 @@
+package models
+
+import "time"
+
+// Frequency is how often a recurring expense is due.
+type Frequency string
+
+const (
+	FrequencyWeekly    Frequency = "weekly"
+	FrequencyBiweekly  Frequency = "biweekly"
+	FrequencyMonthly   Frequency = "monthly"
+	FrequencyQuarterly Frequency = "quarterly"
+	FrequencyYearly    Frequency = "yearly"
+)
+
+// Valid reports whether f is one of the supported frequencies.
+func (f Frequency) Valid() bool {
+	_, days := f.step()
+	_, months := f.monthStep()
+	return days || months
+}
+
+// UsesDayOfMonth reports whether occurrences fall on a day of the month
+// (as opposed to every N days from the anchor date).
+func (f Frequency) UsesDayOfMonth() bool {
+	_, ok := f.monthStep()
+	return ok
+}
+
+func (f Frequency) step() (int, bool) {
+	switch f {
+	case FrequencyWeekly:
+		return 7, true
+	case FrequencyBiweekly:
+		return 14, true
+	}
+	return 0, false
+}
+
+func (f Frequency) monthStep() (int, bool) {
+	switch f {
+	case FrequencyMonthly, "":
+		return 1, true
+	case FrequencyQuarterly:
+		return 3, true
+	case FrequencyYearly:
+		return 12, true
+	}
+	return 0, false
+}
+
+// Date truncates t to midnight UTC keeping its calendar day, so that dates
+// coming from different time zones compare by day.
+func Date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// Anchor is the date periods are counted from: StartsOn when set, otherwise
+// the creation date.
+func (m MonthlyExpense) Anchor() time.Time {
+	if m.StartsOn != nil {
+		return Date(*m.StartsOn)
+	}
+	return Date(m.CreatedAt)
+}
+
+// NotStarted reports whether now is before StartsOn.
+func (m MonthlyExpense) NotStarted(now time.Time) bool {
+	return m.StartsOn != nil && Date(now).Before(Date(*m.StartsOn))
+}
+
+// Ended reports whether now is after EndsOn.
+func (m MonthlyExpense) Ended(now time.Time) bool {
+	return m.EndsOn != nil && Date(now).After(Date(*m.EndsOn))
+}
+
+// Exhausted reports whether the template reached MaxOccurrences.
+func (m MonthlyExpense) Exhausted() bool {
+	return m.MaxOccurrences != nil && m.Occurrences >= *m.MaxOccurrences
+}
+
+// IsDue reports whether the template can be applied in the period that
+// contains now.
+func (m MonthlyExpense) IsDue(now time.Time) bool {
+	return !m.Paused && !m.NotStarted(now) && !m.Ended(now) && !m.Exhausted() && !m.AppliedInPeriod(now)
+}
+
+// PeriodStart returns the first day of the period that contains t. Monthly
+// frequencies use calendar months (blocks of 3 or 12 months starting at the
+// anchor month for quarterly and yearly); weekly ones use blocks of 7 or 14
+// days starting at the anchor date.
+func (m MonthlyExpense) PeriodStart(t time.Time) time.Time {
+	anchor := m.Anchor()
+	day := Date(t)
+	if days, ok := m.Frequency.step(); ok {
+		elapsed := int(day.Sub(anchor).Hours() / 24)
+		return anchor.AddDate(0, 0, floorDiv(elapsed, days)*days)
+	}
+	months, _ := m.Frequency.monthStep()
+	elapsed := (day.Year()-anchor.Year())*12 + int(day.Month()-anchor.Month())
+	return time.Date(anchor.Year(), anchor.Month()+time.Month(floorDiv(elapsed, months)*months), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// NextPeriodStart returns the start of the period following the one that
+// begins at start.
+func (m MonthlyExpense) NextPeriodStart(start time.Time) time.Time {
+	if days, ok := m.Frequency.step(); ok {
+		return start.AddDate(0, 0, days)
+	}
+	months, _ := m.Frequency.monthStep()
+	return start.AddDate(0, months, 0)
+}
+
+// OccurrenceDate returns the date the expense is due within the period that
+// begins at periodStart. For monthly frequencies the day is DayOfMonth (or the
+// anchor's day) clamped to the length of the month, so 31 becomes 28/29 in
+// February.
+func (m MonthlyExpense) OccurrenceDate(periodStart time.Time) time.Time {
+	if !m.Frequency.UsesDayOfMonth() {
+		return periodStart
+	}
+	day := m.Anchor().Day()
+	if m.DayOfMonth != nil {
+		day = *m.DayOfMonth
+	}
+	lastDay := time.Date(periodStart.Year(), periodStart.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(periodStart.Year(), periodStart.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+// AppliedInPeriod reports whether the template was already applied in the
+// period that contains now.
+func (m MonthlyExpense) AppliedInPeriod(now time.Time) bool {
+	return m.LastAppliedAt != nil && !Date(*m.LastAppliedAt).Before(m.PeriodStart(now))
+}
+
+// MaxCatchUpOccurrences bounds how many missed periods are generated at once.
+const MaxCatchUpOccurrences = 366
+
+// MissedOccurrences lists the due dates, oldest first, of every period since
+// the last application (or since the anchor if it was never applied) whose due
+// date is on or before now. Dates after EndsOn and beyond MaxOccurrences are
+// left out; a paused template has none.
+func (m MonthlyExpense) MissedOccurrences(now time.Time) []time.Time {
+	if m.Paused {
+		return nil
+	}
+	today := Date(now)
+	if m.EndsOn != nil && Date(*m.EndsOn).Before(today) {
+		today = Date(*m.EndsOn)
+	}
+	limit := MaxCatchUpOccurrences
+	if m.MaxOccurrences != nil && *m.MaxOccurrences-m.Occurrences < limit {
+		limit = *m.MaxOccurrences - m.Occurrences
+	}
+	anchor := m.Anchor()
+
+	start := m.PeriodStart(anchor)
+	if m.LastAppliedAt != nil {
+		start = m.NextPeriodStart(m.PeriodStart(*m.LastAppliedAt))
+	}
+
+	var dates []time.Time
+	for period := start; !period.After(today) && len(dates) < limit; period = m.NextPeriodStart(period) {
+		due := m.OccurrenceDate(period)
+		if due.Before(anchor) {
+			continue
+		}
+		if due.After(today) {
+			break
+		}
+		dates = append(dates, due)
+	}
+	return dates
+}
+
+// OccurrencesBetween lists the due dates in [from, to), oldest first, that
+// are still pending: periods already applied are skipped, and StartsOn,
+// EndsOn, MaxOccurrences and pausing are honoured.
+func (m MonthlyExpense) OccurrencesBetween(from, to time.Time) []time.Time {
+	if m.Paused {
+		return nil
+	}
+	from, to = Date(from), Date(to)
+	limit := MaxCatchUpOccurrences
+	if m.MaxOccurrences != nil {
+		limit = *m.MaxOccurrences - m.Occurrences
+	}
+	anchor := m.Anchor()
+
+	var dates []time.Time
+	for period := m.PeriodStart(from); period.Before(to) && len(dates) < limit; period = m.NextPeriodStart(period) {
+		due := m.OccurrenceDate(period)
+		if m.EndsOn != nil && due.After(Date(*m.EndsOn)) {
+			break
+		}
+		if due.Before(from) || due.Before(anchor) || !due.Before(to) || m.AppliedInPeriod(due) {
+			continue
+		}
+		dates = append(dates, due)
+	}
+	return dates
+}
+
+// Recurrence returns the template's schedule as a MonthlyExpense, so recurring
+// incomes share the period arithmetic of recurring expenses.
+func (m MonthlyIncome) Recurrence() MonthlyExpense {
+	return MonthlyExpense{
+		Frequency:      m.Frequency,
+		DayOfMonth:     m.DayOfMonth,
+		CreatedAt:      m.CreatedAt,
+		StartsOn:       m.StartsOn,
+		EndsOn:         m.EndsOn,
+		Paused:         m.Paused,
+		LastAppliedAt:  m.LastAppliedAt,
+		MaxOccurrences: m.MaxOccurrences,
+		Occurrences:    m.Occurrences,
+	}
+}
+
+// IsDue reports whether the template can be applied in the period that
+// contains now.
+func (m MonthlyIncome) IsDue(now time.Time) bool {
+	return m.Recurrence().IsDue(now)
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestPeriodStart_Monthly(t *testing.T) {
+	m := MonthlyExpense{Frequency: FrequencyMonthly, CreatedAt: day(2024, 1, 20)}
+
+	assert.Equal(t, day(2024, 3, 1), m.PeriodStart(day(2024, 3, 31)))
+	assert.Equal(t, day(2024, 4, 1), m.NextPeriodStart(day(2024, 3, 1)))
+}
+
+func TestPeriodStart_QuarterlyAndYearlyUseAnchorMonth(t *testing.T) {
+	quarterly := MonthlyExpense{Frequency: FrequencyQuarterly, CreatedAt: day(2024, 2, 10)}
+	assert.Equal(t, day(2024, 2, 1), quarterly.PeriodStart(day(2024, 4, 30)))
+	assert.Equal(t, day(2024, 5, 1), quarterly.PeriodStart(day(2024, 5, 1)))
+	assert.Equal(t, day(2023, 11, 1), quarterly.PeriodStart(day(2024, 1, 5)))
+
+	yearly := MonthlyExpense{Frequency: FrequencyYearly, CreatedAt: day(2023, 7, 1)}
+	assert.Equal(t, day(2024, 7, 1), yearly.PeriodStart(day(2025, 6, 30)))
+}
+
+func TestPeriodStart_WeeklyAndBiweeklyCountFromAnchor(t *testing.T) {
+	weekly := MonthlyExpense{Frequency: FrequencyWeekly, CreatedAt: day(2024, 3, 6)}
+	assert.Equal(t, day(2024, 3, 13), weekly.PeriodStart(day(2024, 3, 19)))
+
+	biweekly := MonthlyExpense{Frequency: FrequencyBiweekly, CreatedAt: day(2024, 3, 6)}
+	assert.Equal(t, day(2024, 3, 6), biweekly.PeriodStart(day(2024, 3, 19)))
+	assert.Equal(t, day(2024, 3, 20), biweekly.PeriodStart(day(2024, 3, 20)))
+	assert.Equal(t, day(2024, 3, 20), biweekly.NextPeriodStart(day(2024, 3, 6)))
+}
+
+func TestOccurrenceDate_ClampsShortMonths(t *testing.T) {
+	dayOfMonth := 31
+	m := MonthlyExpense{Frequency: FrequencyMonthly, DayOfMonth: &dayOfMonth, CreatedAt: day(2024, 1, 1)}
+
+	assert.Equal(t, day(2024, 2, 29), m.OccurrenceDate(day(2024, 2, 1)))
+	assert.Equal(t, day(2023, 2, 28), m.OccurrenceDate(day(2023, 2, 1)))
+	assert.Equal(t, day(2024, 4, 30), m.OccurrenceDate(day(2024, 4, 1)))
+
+	withoutDay := MonthlyExpense{Frequency: FrequencyMonthly, CreatedAt: day(2024, 1, 15)}
+	assert.Equal(t, day(2024, 2, 15), withoutDay.OccurrenceDate(day(2024, 2, 1)))
+}
+
+func TestAppliedInPeriod(t *testing.T) {
+	applied := day(2024, 3, 2)
+	m := MonthlyExpense{Frequency: FrequencyMonthly, CreatedAt: day(2024, 1, 1), LastAppliedAt: &applied}
+
+	assert.True(t, m.AppliedInPeriod(day(2024, 3, 31)))
+	assert.False(t, m.AppliedInPeriod(day(2024, 4, 1)))
+
+	m.Frequency = FrequencyYearly
+	assert.True(t, m.AppliedInPeriod(day(2024, 12, 31)))
+
+	m.LastAppliedAt = nil
+	assert.False(t, m.AppliedInPeriod(day(2024, 3, 31)))
+}
+
+func TestFrequencyValid(t *testing.T) {
+	assert.True(t, FrequencyBiweekly.Valid())
+	assert.False(t, Frequency("daily").Valid())
+	assert.True(t, FrequencyQuarterly.UsesDayOfMonth())
+	assert.False(t, FrequencyWeekly.UsesDayOfMonth())
+}
+
+func TestMissedOccurrences(t *testing.T) {
+	dayOfMonth := 10
+	applied := day(2024, 1, 10)
+	m := MonthlyExpense{
+		Frequency:     FrequencyMonthly,
+		DayOfMonth:    &dayOfMonth,
+		CreatedAt:     day(2023, 12, 1),
+		LastAppliedAt: &applied,
+	}
+
+	// April's due date has not arrived yet
+	assert.Equal(t, []time.Time{day(2024, 2, 10), day(2024, 3, 10)}, m.MissedOccurrences(day(2024, 4, 5)))
+
+	m.LastAppliedAt = nil
+	assert.Equal(t, []time.Time{day(2023, 12, 10), day(2024, 1, 10)}, m.MissedOccurrences(day(2024, 1, 31)))
+}
+
+func TestMissedOccurrences_SkipsDatesBeforeAnchor(t *testing.T) {
+	dayOfMonth := 5
+	m := MonthlyExpense{Frequency: FrequencyMonthly, DayOfMonth: &dayOfMonth, CreatedAt: day(2024, 3, 20)}
+
+	assert.Equal(t, []time.Time{day(2024, 4, 5)}, m.MissedOccurrences(day(2024, 4, 30)))
+	assert.Empty(t, m.MissedOccurrences(day(2024, 3, 31)))
+}
+
+func TestMissedOccurrences_Weekly(t *testing.T) {
+	applied := day(2024, 3, 6)
+	m := MonthlyExpense{Frequency: FrequencyWeekly, CreatedAt: day(2024, 3, 6), LastAppliedAt: &applied}
+
+	assert.Equal(t, []time.Time{day(2024, 3, 13), day(2024, 3, 20)}, m.MissedOccurrences(day(2024, 3, 25)))
+}
+
+func TestIsDue_Lifecycle(t *testing.T) {
+	startsOn := day(2024, 3, 1)
+	endsOn := day(2024, 6, 30)
+	maxOccurrences := 2
+	m := MonthlyExpense{Frequency: FrequencyMonthly, CreatedAt: day(2024, 1, 10), StartsOn: &startsOn, EndsOn: &endsOn}
+
+	assert.Equal(t, day(2024, 3, 1), m.Anchor())
+	assert.False(t, m.IsDue(day(2024, 2, 28)))
+	assert.True(t, m.IsDue(day(2024, 3, 1)))
+	assert.True(t, m.IsDue(day(2024, 6, 30)))
+	assert.False(t, m.IsDue(day(2024, 7, 1)))
+
+	m.Paused = true
+	assert.False(t, m.IsDue(day(2024, 4, 15)))
+
+	m.Paused = false
+	m.MaxOccurrences = &maxOccurrences
+	m.Occurrences = 2
+	assert.False(t, m.IsDue(day(2024, 4, 15)))
+}
+
+func TestMissedOccurrences_RespectsLifecycle(t *testing.T) {
+	endsOn := day(2024, 4, 10)
+	m := MonthlyExpense{Frequency: FrequencyMonthly, CreatedAt: day(2024, 1, 5), EndsOn: &endsOn}
+	assert.Equal(t, []time.Time{day(2024, 1, 5), day(2024, 2, 5), day(2024, 3, 5), day(2024, 4, 5)}, m.MissedOccurrences(day(2024, 8, 1)))
+
+	maxOccurrences := 3
+	m.MaxOccurrences = &maxOccurrences
+	m.Occurrences = 1
+	assert.Equal(t, []time.Time{day(2024, 1, 5), day(2024, 2, 5)}, m.MissedOccurrences(day(2024, 8, 1)))
+
+	m.Paused = true
+	assert.Empty(t, m.MissedOccurrences(day(2024, 8, 1)))
+}
+
+func TestOccurrencesBetween(t *testing.T) {
+	applied := day(2024, 3, 10)
+	maxOccurrences := 4
+	m := MonthlyExpense{
+		Frequency:      FrequencyMonthly,
+		CreatedAt:      day(2024, 1, 10),
+		LastAppliedAt:  &applied,
+		MaxOccurrences: &maxOccurrences,
+		Occurrences:    2,
+	}
+
+	// March is already applied and only two occurrences remain.
+	assert.Equal(t, []time.Time{day(2024, 4, 10), day(2024, 5, 10)}, m.OccurrencesBetween(day(2024, 3, 1), day(2024, 9, 1)))
+
+	weekly := MonthlyExpense{Frequency: FrequencyWeekly, CreatedAt: day(2024, 3, 6)}
+	assert.Equal(t, []time.Time{day(2024, 4, 3), day(2024, 4, 10), day(2024, 4, 17), day(2024, 4, 24)},
+		weekly.OccurrencesBetween(day(2024, 4, 1), day(2024, 5, 1)))
+
+	weekly.Paused = true
+	assert.Empty(t, weekly.OccurrencesBetween(day(2024, 4, 1), day(2024, 5, 1)))
+}
+
+func TestMonthlyIncome_IsDue(t *testing.T) {
+	applied := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	item := MonthlyIncome{Frequency: FrequencyMonthly, CreatedAt: day(2024, 1, 1), LastAppliedAt: &applied}
+
+	assert.False(t, item.IsDue(day(2024, 3, 20)))
+	assert.True(t, item.IsDue(day(2024, 4, 1)))
+
+	item.Paused = true
+	assert.False(t, item.IsDue(day(2024, 4, 1)))
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CategorizationRule assigns a category to expenses that arrive without a
+// tag. Every condition that is set must match: NameContains is compared
+// ignoring case, NamePattern is a Go regular expression over the name, and
+// MinAmount/MaxAmount bound the amount in Currency, so a rule with amount
+// bounds never matches an expense recorded in another currency. Rules are
+// evaluated by ascending Priority and the first match wins.
+type CategorizationRule struct {
+	ID           int64  `json:"id"`
+	UserID       int64  `json:"-"`
+	Priority     int    `json:"priority"`
+	NameContains string `json:"nameContains,omitempty"`
+	NamePattern  string `json:"namePattern,omitempty"`
+	MinAmount    *Money `json:"minAmount,omitempty"`
+	MaxAmount    *Money `json:"maxAmount,omitempty"`
+	Currency     string `json:"currency"`
+	CategoryID   int64  `json:"categoryId"`
+	// Tag is the name of the category, as it is stored on expenses.
+	Tag       string    `json:"tag"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type compiledRule struct {
+	rule     CategorizationRule
+	contains string
+	pattern  *regexp.Regexp
+}
+
+// RuleSet is a list of rules ready to be matched, in evaluation order.
+type RuleSet []compiledRule
+
+// NewRuleSet compiles the rules, which must already be sorted by priority.
+// Rules whose pattern does not compile are skipped.
+func NewRuleSet(rules []CategorizationRule) RuleSet {
+	set := make(RuleSet, 0, len(rules))
+	for _, rule := range rules {
+		compiled := compiledRule{rule: rule, contains: strings.ToLower(rule.NameContains)}
+		if rule.NamePattern != "" {
+			pattern, err := regexp.Compile(rule.NamePattern)
+			if err != nil {
+				continue
+			}
+			compiled.pattern = pattern
+		}
+		set = append(set, compiled)
+	}
+	return set
+}
+
+// Match returns the first rule that matches the expense, or nil.
+func (s RuleSet) Match(name string, amount Money, currency string) *CategorizationRule {
+	lowerName := strings.ToLower(name)
+	for i := range s {
+		r := &s[i]
+		if r.contains != "" && !strings.Contains(lowerName, r.contains) {
+			continue
+		}
+		if r.pattern != nil && !r.pattern.MatchString(name) {
+			continue
+		}
+		if (r.rule.MinAmount != nil || r.rule.MaxAmount != nil) && currency != r.rule.Currency {
+			continue
+		}
+		if r.rule.MinAmount != nil && amount < *r.rule.MinAmount {
+			continue
+		}
+		if r.rule.MaxAmount != nil && amount > *r.rule.MaxAmount {
+			continue
+		}
+		return &r.rule
+	}
+	return nil
+}
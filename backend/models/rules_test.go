@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleSetMatch(t *testing.T) {
+	min, max := Money(100000), Money(500000)
+	rules := NewRuleSet([]CategorizationRule{
+		{ID: 1, Priority: 1, NameContains: "UBER", MaxAmount: &max, Currency: "ARS", Tag: "Transporte"},
+		{ID: 2, Priority: 2, NamePattern: `^(Coto|Dia|Carrefour)\b`, Currency: "ARS", Tag: "Supermercado"},
+		{ID: 3, Priority: 3, NamePattern: `(`, Currency: "ARS", Tag: "Inválida"},
+		{ID: 4, Priority: 4, MinAmount: &min, Currency: "ARS", Tag: "Grandes compras"},
+	})
+
+	// Contains ignores case, and the amount range limits the match.
+	assert.Equal(t, int64(1), rules.Match("Viaje uber al centro", 250000, "ARS").ID)
+	assert.Equal(t, int64(4), rules.Match("Viaje uber al aeropuerto", 600000, "ARS").ID)
+
+	// Patterns are case sensitive unless they say otherwise.
+	assert.Equal(t, int64(2), rules.Match("Coto Palermo", 20000, "ARS").ID)
+	assert.Nil(t, rules.Match("coto palermo", 20000, "ARS"))
+
+	// The invalid pattern is skipped instead of matching everything.
+	assert.Len(t, rules, 3)
+	assert.Nil(t, rules.Match("Kiosco", 5000, "ARS"))
+}
+
+func TestRuleSetMatch_AmountBoundsUseRuleCurrency(t *testing.T) {
+	max := Money(500000)
+	rules := NewRuleSet([]CategorizationRule{
+		{ID: 1, NameContains: "uber", MaxAmount: &max, Currency: "ARS", Tag: "Transporte"},
+		{ID: 2, NameContains: "uber", Currency: "ARS", Tag: "Viajes"},
+	})
+
+	// USD 40 is below the ARS bound as a number but not in value, so only the
+	// rule without amount bounds applies.
+	assert.Equal(t, int64(1), rules.Match("Uber", 4000, "ARS").ID)
+	assert.Equal(t, int64(2), rules.Match("Uber", 4000, "USD").ID)
+}
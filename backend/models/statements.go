@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Statement is one billing cycle of a credit card. It covers the purchases
+// made after the previous closing date up to ClosingDate, and is debited on
+// DueDate. Total is in the card's currency; charges in other currencies are
+// billed separately and kept in Foreign.
+type Statement struct {
+	ClosingDate string           `json:"closingDate"`
+	DueDate     string           `json:"dueDate"`
+	Total       Money            `json:"total"`
+	Expenses    int64            `json:"expenses"`
+	Foreign     map[string]Money `json:"foreign,omitempty"`
+}
+
+// dayOfMonth returns the given day of the month, clamped to its last day.
+func dayOfMonth(year int, month time.Month, day int) time.Time {
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// HasStatementCycle reports whether the account is a credit card with its
+// closing and due days set.
+func (a Account) HasStatementCycle() bool {
+	return a.Type == AccountCreditCard && a.ClosingDay != nil && a.DueDay != nil
+}
+
+// ClosingDateIn returns the date the statement closes in the month of t.
+func (a Account) ClosingDateIn(t time.Time) time.Time {
+	return dayOfMonth(t.Year(), t.Month(), *a.ClosingDay)
+}
+
+// StatementClosing returns the closing date of the statement a purchase made
+// on date belongs to: the closing day of that month if it has not passed yet,
+// otherwise the one of the following month.
+func (a Account) StatementClosing(date time.Time) time.Time {
+	date = Date(date)
+	closing := a.ClosingDateIn(date)
+	if date.After(closing) {
+		next := time.Date(date.Year(), date.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		closing = a.ClosingDateIn(next)
+	}
+	return closing
+}
+
+// StatementDue returns the due date of the statement that closes on closing:
+// the first DueDay strictly after it.
+func (a Account) StatementDue(closing time.Time) time.Time {
+	due := dayOfMonth(closing.Year(), closing.Month(), *a.DueDay)
+	if !due.After(closing) {
+		next := time.Date(closing.Year(), closing.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		due = dayOfMonth(next.Year(), next.Month(), *a.DueDay)
+	}
+	return due
+}
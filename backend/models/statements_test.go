@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func card(closingDay, dueDay int) Account {
+	return Account{Type: AccountCreditCard, ClosingDay: &closingDay, DueDay: &dueDay}
+}
+
+func TestStatementClosing(t *testing.T) {
+	c := card(25, 8)
+
+	// A purchase on the closing day belongs to that statement, the next day to the following one.
+	assert.Equal(t, day(2024, 3, 25), c.StatementClosing(day(2024, 3, 25)))
+	assert.Equal(t, day(2024, 4, 25), c.StatementClosing(day(2024, 3, 26)))
+	assert.Equal(t, day(2025, 1, 25), c.StatementClosing(day(2024, 12, 30)))
+
+	// The closing day is clamped to the end of short months.
+	c = card(31, 10)
+	assert.Equal(t, day(2024, 2, 29), c.StatementClosing(day(2024, 2, 10)))
+	assert.Equal(t, day(2024, 3, 31), c.StatementClosing(day(2024, 3, 1)))
+}
+
+func TestStatementDue(t *testing.T) {
+	// A due day before the closing day falls in the following month.
+	c := card(25, 8)
+	assert.Equal(t, day(2024, 4, 8), c.StatementDue(day(2024, 3, 25)))
+	assert.Equal(t, day(2025, 1, 8), c.StatementDue(day(2024, 12, 25)))
+
+	// A due day after the closing day falls in the same month.
+	c = card(5, 20)
+	assert.Equal(t, day(2024, 3, 20), c.StatementDue(day(2024, 3, 5)))
+
+	// The same day for both is paid the following month.
+	c = card(15, 15)
+	assert.Equal(t, day(2024, 4, 15), c.StatementDue(day(2024, 3, 15)))
+}
+
+func TestHasStatementCycle(t *testing.T) {
+	assert.True(t, card(25, 8).HasStatementCycle())
+	assert.False(t, Account{Type: AccountCreditCard}.HasStatementCycle())
+
+	bank := card(25, 8)
+	bank.Type = AccountBank
+	assert.False(t, bank.HasStatementCycle())
+}
@@ -17,18 +17,94 @@ func Setup(cfg *config.Config, handler *controllers.Handler) *gin.Engine {
 	auth.POST("/register", handler.Register)
 	auth.POST("/login", handler.Login)
 	auth.GET("/me", middleware.Auth(handler.JWTSecret), handler.Me)
+	auth.PATCH("/me", middleware.Auth(handler.JWTSecret), handler.UpdateMe)
 
 	protected := api.Group("/")
 	protected.Use(middleware.Auth(handler.JWTSecret))
 	{
 		protected.GET("/expenses", handler.ListExpenses)
 		protected.POST("/expenses", handler.CreateExpense)
+		protected.PUT("/expenses/:id", handler.UpdateExpense)
+		protected.PATCH("/expenses/:id", handler.PatchExpense)
 		protected.DELETE("/expenses/:id", handler.DeleteExpense)
 
 		protected.GET("/monthly-expenses", handler.ListMonthlyExpenses)
 		protected.POST("/monthly-expenses", handler.CreateMonthlyExpense)
+		protected.PATCH("/monthly-expenses/:id", handler.UpdateMonthlyExpense)
 		protected.DELETE("/monthly-expenses/:id", handler.DeleteMonthlyExpense)
+		protected.POST("/monthly-expenses/apply-due", handler.ApplyDueMonthlyExpensesNow)
 		protected.POST("/monthly-expenses/:id/apply", handler.ApplyMonthlyExpense)
+		protected.DELETE("/monthly-expenses/:id/apply", handler.UndoMonthlyExpenseApplication)
+		protected.POST("/monthly-expenses/:id/catch-up", handler.CatchUpMonthlyExpense)
+		protected.POST("/monthly-expenses/:id/pause", handler.PauseMonthlyExpense)
+		protected.POST("/monthly-expenses/:id/resume", handler.ResumeMonthlyExpense)
+		protected.GET("/monthly-expenses/:id/history", handler.MonthlyExpenseHistory)
+
+		protected.GET("/incomes", handler.ListIncomes)
+		protected.POST("/incomes", handler.CreateIncome)
+		protected.PATCH("/incomes/:id", handler.PatchIncome)
+		protected.DELETE("/incomes/:id", handler.DeleteIncome)
+
+		protected.GET("/monthly-incomes", handler.ListMonthlyIncomes)
+		protected.POST("/monthly-incomes", handler.CreateMonthlyIncome)
+		protected.PATCH("/monthly-incomes/:id", handler.UpdateMonthlyIncome)
+		protected.DELETE("/monthly-incomes/:id", handler.DeleteMonthlyIncome)
+		protected.POST("/monthly-incomes/:id/apply", handler.ApplyMonthlyIncome)
+		protected.POST("/monthly-incomes/:id/pause", handler.PauseMonthlyIncome)
+		protected.POST("/monthly-incomes/:id/resume", handler.ResumeMonthlyIncome)
+
+		protected.GET("/accounts", handler.ListAccounts)
+		protected.POST("/accounts", handler.CreateAccount)
+		protected.GET("/accounts/balances", handler.AccountBalances)
+		protected.PATCH("/accounts/:id", handler.UpdateAccount)
+		protected.DELETE("/accounts/:id", handler.DeleteAccount)
+
+		protected.GET("/cards/:id/statements", handler.CardStatements)
+
+		protected.GET("/transfers", handler.ListTransfers)
+		protected.POST("/transfers", handler.CreateTransfer)
+		protected.DELETE("/transfers/:id", handler.DeleteTransfer)
+
+		protected.GET("/installment-plans", handler.ListInstallmentPlans)
+		protected.POST("/installment-plans", handler.CreateInstallmentPlan)
+		protected.POST("/installment-plans/:id/cancel", handler.CancelInstallmentPlan)
+
+		protected.GET("/reports/summary", handler.SpendingSummary)
+		protected.GET("/reports/cash-flow", handler.CashFlow)
+		protected.GET("/reports/categories", handler.CategoryRollup)
+		protected.GET("/forecast", handler.Forecast)
+
+		protected.GET("/categories", handler.ListCategories)
+		protected.POST("/categories", handler.CreateCategory)
+		protected.PATCH("/categories/:id", handler.UpdateCategory)
+		protected.DELETE("/categories/:id", handler.DeleteCategory)
+		protected.POST("/categories/:id/merge", handler.MergeCategory)
+
+		protected.GET("/categorization-rules", handler.ListCategorizationRules)
+		protected.POST("/categorization-rules", handler.CreateCategorizationRule)
+		protected.GET("/categorization-rules/preview", handler.PreviewCategorizationRules)
+		protected.POST("/categorization-rules/apply", handler.ApplyCategorizationRules)
+		protected.PATCH("/categorization-rules/:id", handler.UpdateCategorizationRule)
+		protected.DELETE("/categorization-rules/:id", handler.DeleteCategorizationRule)
+
+		protected.GET("/budgets", handler.ListBudgets)
+		protected.POST("/budgets", handler.CreateBudget)
+		protected.GET("/budgets/status", handler.BudgetsStatus)
+		protected.GET("/budgets/envelopes", handler.BudgetEnvelopes)
+		protected.PATCH("/budgets/:id", handler.UpdateBudget)
+		protected.DELETE("/budgets/:id", handler.DeleteBudget)
+
+		protected.GET("/exchange-rates", handler.ListExchangeRates)
+		protected.GET("/price-indexes", handler.ListPriceIndexes)
+	}
+
+	admin := api.Group("/admin")
+	admin.Use(middleware.Auth(handler.JWTSecret), handler.RequireAdmin)
+	{
+		admin.POST("/exchange-rates", handler.UpsertExchangeRates)
+		admin.POST("/exchange-rates/csv", handler.ImportExchangeRatesCSV)
+		admin.POST("/price-indexes", handler.UpsertPriceIndexes)
+		admin.POST("/price-indexes/csv", handler.ImportPriceIndexesCSV)
 	}
 
 	return router
@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// RecurringExpensesLockKey identifies the advisory lock that guards the
+// automatic application of recurring expenses across replicas.
+const RecurringExpensesLockKey int64 = 7_301_001
+
+// Job is a unit of background work executed on every tick.
+type Job func(ctx context.Context) error
+
+// Run executes job immediately and then every interval until ctx is cancelled.
+// Each run first takes a Postgres session advisory lock so that only one
+// replica does the work; the others skip that tick.
+func Run(ctx context.Context, db *sql.DB, interval time.Duration, lockKey int64, name string, job Job) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := runLocked(ctx, db, lockKey, job); err != nil {
+			log.Printf("scheduler %s: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runLocked runs job only if the advisory lock could be acquired. It reports
+// whether the job ran.
+func runLocked(ctx context.Context, db *sql.DB, lockKey int64, job Job) (bool, error) {
+	// Session-level advisory locks belong to a connection, so lock and unlock
+	// must go through the same one instead of the pool.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			log.Printf("scheduler: could not release advisory lock %d: %v", lockKey, err)
+		}
+	}()
+
+	return true, job(ctx)
+}
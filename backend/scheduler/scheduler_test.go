@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLocked_RunsJobWhenLockAcquired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WithArgs(RecurringExpensesLockKey).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	mock.ExpectExec("SELECT pg_advisory_unlock").
+		WithArgs(RecurringExpensesLockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	calls := 0
+	ran, err := runLocked(context.Background(), db, RecurringExpensesLockKey, func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, 1, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunLocked_SkipsWhenLockHeldElsewhere(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WithArgs(RecurringExpensesLockKey).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+	ran, err := runLocked(context.Background(), db, RecurringExpensesLockKey, func(ctx context.Context) error {
+		t.Fatal("job must not run without the lock")
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.False(t, ran)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunLocked_ReleasesLockWhenJobFails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WithArgs(RecurringExpensesLockKey).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	mock.ExpectExec("SELECT pg_advisory_unlock").
+		WithArgs(RecurringExpensesLockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	jobErr := errors.New("boom")
+	ran, err := runLocked(context.Background(), db, RecurringExpensesLockKey, func(ctx context.Context) error {
+		return jobErr
+	})
+
+	assert.True(t, ran)
+	assert.ErrorIs(t, err, jobErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}